@@ -3,10 +3,17 @@ package main
 import (
 	"github.com/inksnw/shadowresource/cmd/options"
 	v1 "github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	pkgconfig "github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/events"
+	"github.com/inksnw/shadowresource/pkg/gc"
 	"github.com/inksnw/shadowresource/pkg/informer"
+	"github.com/inksnw/shadowresource/pkg/leader"
+	"github.com/inksnw/shadowresource/pkg/metrics"
 	"github.com/inksnw/shadowresource/pkg/store"
 	"github.com/inksnw/shadowresource/pkg/utils"
 	"github.com/phuslu/log"
+	"github.com/spf13/pflag"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -14,17 +21,34 @@ import (
 	"k8s.io/apiserver/pkg/features"
 	"k8s.io/apiserver/pkg/registry/rest"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/healthz"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 )
 
 func main() {
+	options.AddFlags(pflag.CommandLine)
+	pflag.Parse()
+
+	if err := pkgconfig.Init("", ""); err != nil {
+		log.Fatal().Msgf("初始化k8s客户端失败 %s", err)
+	}
 	utils.InitMapper()
 	log.Info().Msgf("载入restMapper 完成")
 
+	stopCh := genericapiserver.SetupSignalHandler()
+	cluster.Start(stopCh)
+	events.Start(stopCh)
+	metrics.Register(informer.CountStates)
 	server := generateServer()
-	informer.ReloadInformer()
+	informer.ReloadInformer(stopCh)
+	leader.Run(stopCh, informer.Resync)
+	gc.Run(stopCh)
+	server.AddPreShutdownHookOrDie("stop-informers", func() error {
+		informer.Shutdown()
+		return nil
+	})
 
-	err := server.PrepareRun().Run(genericapiserver.SetupSignalHandler())
+	err := server.PrepareRun().Run(stopCh)
 	if err != nil {
 		log.Fatal().Msgf(err.Error())
 	}
@@ -47,7 +71,7 @@ func generateServer() *genericapiserver.GenericAPIServer {
 	}
 	gvi := v1.SchemeGroupVersion
 	gvi.Version = runtime.APIVersionInternal
-	options.Scheme.AddKnownTypes(gvi, &v1.ShadowResource{}, &v1.ShadowResourceList{})
+	options.Scheme.AddKnownTypes(gvi, &v1.ShadowResource{}, &v1.ShadowResourceList{}, &v1.ShadowResourceDiff{})
 
 	agi := genericapiserver.NewDefaultAPIGroupInfo(
 		v1.SchemeGroupVersion.Group,
@@ -74,6 +98,8 @@ func generateServer() *genericapiserver.GenericAPIServer {
 	resources := map[string]rest.Storage{
 		"shadowresources": store.NewMyStore(v1.SchemeGroupResource, true,
 			rest.NewDefaultTableConvertor(v1.SchemeGroupResource)),
+		"shadowresources/diff":   store.NewDiffStore(),
+		"shadowresources/export": store.NewExportStore(),
 	}
 	agi.VersionedResourcesStorageMap[v1.SchemeGroupVersion.Version] = resources
 	server, err := completeConfig.New("myapi", genericapiserver.NewEmptyDelegate())
@@ -84,5 +110,9 @@ func generateServer() *genericapiserver.GenericAPIServer {
 	if err != nil {
 		log.Fatal().Msgf(err.Error())
 	}
+	err = server.AddReadyzChecks(healthz.NamedCheck("informer-sync", informer.CheckSynced))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
 	return server
 }
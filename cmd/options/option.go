@@ -1,7 +1,10 @@
 package options
 
 import (
+	"github.com/inksnw/shadowresource/pkg/admission/limits"
 	v1 "github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
@@ -12,13 +15,47 @@ var (
 	Codecs = serializer.NewCodecFactory(Scheme)
 )
 
+var rcOpt *genericoptions.RecommendedOptions
+
 func GetRcOpt() *genericoptions.RecommendedOptions {
+	if rcOpt != nil {
+		return rcOpt
+	}
 	rc := genericoptions.NewRecommendedOptions("", Codecs.LegacyCodec(v1.SchemeGroupVersion))
 	rc.SecureServing.BindPort = 443
-	rc.CoreAPI = nil
-	rc.Admission = nil
+	// admission 依赖 CoreAPI 提供的informer和客户端, 与服务使用同一份kubeconfig
+	rc.CoreAPI.CoreAPIKubeconfigPath = config.KubeconfigPath()
+	limits.Register(rc.Admission.Plugins)
+	rc.Admission.RecommendedPluginOrder = append(rc.Admission.RecommendedPluginOrder, limits.PluginName)
 	rc.Authorization = nil
 	rc.Authentication = nil
 
+	rcOpt = rc
 	return rc
 }
+
+func AddFlags(fs *pflag.FlagSet) {
+	GetRcOpt().Admission.AddFlags(fs)
+	fs.BoolVar(&config.LiveReadOnEmptyRV, "live-read-on-empty-rv", false,
+		"serve get/list requests with an empty resourceVersion from the api server instead of the informer cache")
+	fs.IntVar(&config.FetchWorkers, "fetch-workers", config.FetchWorkers,
+		"number of children fetched concurrently when getting a shadowresource")
+	fs.IntVar(&config.ApplyWorkers, "apply-workers", config.ApplyWorkers,
+		"number of children applied concurrently within one wave")
+	fs.StringVar(&config.ClusterNamespace, "cluster-namespace", config.ClusterNamespace,
+		"namespace holding the kubeconfig secrets of target clusters")
+	fs.StringSliceVar(&config.CrossNamespacePolicy, "cross-namespace-allow", nil,
+		"rules allowing a shadow to create children in another namespace, as source:target, either side may be *")
+	fs.StringSliceVar(&config.ClusterScopedNamespaces, "cluster-scoped-allow", nil,
+		"namespaces whose shadows may create cluster-scoped children, * allows all")
+	fs.BoolVar(&config.LeaderElect, "leader-elect", false,
+		"run background work only on the replica holding the lease, required when running more than one replica")
+	fs.StringVar(&config.LeaderElectNamespace, "leader-elect-namespace", config.LeaderElectNamespace,
+		"namespace of the lease used for leader election")
+	fs.DurationVar(&config.OrphanScanInterval, "orphan-scan-interval", config.OrphanScanInterval,
+		"interval between scans for children whose shadow no longer exists, 0 disables the scan")
+	fs.DurationVar(&config.OrphanGracePeriod, "orphan-grace-period", config.OrphanGracePeriod,
+		"children younger than this are never reported as orphans")
+	fs.BoolVar(&config.OrphanDelete, "orphan-delete", false,
+		"delete orphaned children found by the scan instead of only logging them")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// runApply 将清单打包为一个ShadowResource提交, 已存在时替换其flowList
+func runApply(fs *pflag.FlagSet, args []string) error {
+	ns := namespaceFlag(fs)
+	filename := fs.StringP("filename", "f", "", "directory, file or - for stdin, every document becomes one flowList item")
+	kustomize := fs.StringP("kustomize", "k", "", "kustomization directory rendered with kubectl kustomize")
+	configMap := fs.String("from-configmap", "", "let the server read the manifests from this ConfigMap in the namespace")
+	cluster := fs.String("cluster", "", "default target cluster of the children")
+	adopt := fs.Bool("adopt", false, "take ownership of children that already exist instead of creating them")
+	name, err := nameArg(fs, args)
+	if err != nil {
+		return err
+	}
+	var tasks []json.RawMessage
+	switch {
+	case *configMap != "":
+	case *filename != "" || *kustomize != "":
+		if tasks, err = readManifests(*filename, *kustomize); err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return fmt.Errorf("no manifests found")
+		}
+	default:
+		return fmt.Errorf("one of -f, -k or --from-configmap is required")
+	}
+
+	shadow := v1.ShadowResource{}
+	shadow.APIVersion = v1.ShadowAPIVersion
+	shadow.Kind = v1.ShadowKind
+	shadow.Name = name
+	shadow.Namespace = *ns
+	shadow.Spec.TargetCluster = *cluster
+	shadow.Spec.Adopt = *adopt
+	if *configMap != "" {
+		shadow.Spec.Source = &v1.FlowSource{ConfigMap: &v1.ConfigMapSource{Name: *configMap}}
+	}
+	for _, js := range tasks {
+		var item v1.FlowItem
+		if err = json.Unmarshal(js, &item); err != nil {
+			return err
+		}
+		shadow.Spec.FlowList = append(shadow.Spec.FlowList, item)
+	}
+	obj, err := utils.ConvertToUnstructured(&shadow)
+	if err != nil {
+		return err
+	}
+
+	_, err = shadows(*ns).Get(context.TODO(), name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		if _, err = shadows(*ns).Create(context.TODO(), obj, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		fmt.Printf("shadowresource/%s created\n", name)
+	case err != nil:
+		return err
+	default:
+		unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+		if _, err = shadows(*ns).Update(context.TODO(), obj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		fmt.Printf("shadowresource/%s configured\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// runClone 将export子资源返回的shadow复制到目标命名空间, 以普通的创建请求提交, 权限与准入检查和直接创建一致
+func runClone(fs *pflag.FlagSet, args []string) error {
+	ns := namespaceFlag(fs)
+	target := fs.String("to-namespace", "", "namespace to create the copy in")
+	prefix := fs.String("prefix", "", "prefix added to the name of the shadowresource and of every child")
+	suffix := fs.String("suffix", "", "suffix added to the name of the shadowresource and of every child")
+	dryRun := fs.Bool("dry-run", false, "print the copy instead of creating it")
+	name, err := nameArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if *target == "" {
+		*target = *ns
+	}
+	if *target == *ns && *prefix == "" && *suffix == "" {
+		return fmt.Errorf("--to-namespace, --prefix or --suffix is required to clone into the same namespace")
+	}
+
+	obj, err := shadows(*ns).Get(context.TODO(), name, metav1.GetOptions{}, "export")
+	if err != nil {
+		return err
+	}
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	shadow := &v1.ShadowResource{}
+	if err = json.Unmarshal(data, shadow); err != nil {
+		return err
+	}
+	clone, err := utils.CloneShadow(shadow, *ns, utils.CloneOptions{Namespace: *target, Prefix: *prefix, Suffix: *suffix})
+	if err != nil {
+		return err
+	}
+	out, err := utils.ConvertToUnstructured(clone)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		data, err = yaml.Marshal(out.Object)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+	if _, err = shadows(*target).Create(context.TODO(), out, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	fmt.Printf("shadowresource/%s created in %s\n", clone.Name, *target)
+	return nil
+}
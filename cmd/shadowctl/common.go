@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	kubeconfig  *string
+	kubeContext *string
+	namespace   *string
+)
+
+// clientFlags 注册kubeconfig相关的flag, 客户端在解析flag后由 connect 创建
+func clientFlags(fs *pflag.FlagSet) {
+	kubeconfig = fs.String("kubeconfig", "", "path to the kubeconfig file to use")
+	kubeContext = fs.String("context", "", "name of the kubeconfig context to use")
+}
+
+// namespaceFlag 未指定时在 connect 中取kubeconfig当前context的命名空间
+func namespaceFlag(fs *pflag.FlagSet) *string {
+	clientFlags(fs)
+	namespace = fs.StringP("namespace", "n", "", "namespace of the shadowresource, defaults to the namespace of the current context")
+	return namespace
+}
+
+// connect 按flag创建集群客户端
+func connect() error {
+	if err := config.Init(*kubeconfig, *kubeContext); err != nil {
+		return err
+	}
+	if namespace != nil && *namespace == "" {
+		*namespace = config.Namespace()
+	}
+	utils.InitMapper()
+	return nil
+}
+
+// nameArg 解析flag后取出唯一的位置参数shadow名, 并初始化集群客户端
+func nameArg(fs *pflag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("expected exactly one shadowresource name, got %d", fs.NArg())
+	}
+	return fs.Arg(0), connect()
+}
+
+func shadows(ns string) dynamic.ResourceInterface {
+	return config.DynamicClient.Resource(v1.ShadowGVR).Namespace(ns)
+}
+
+func getStore(ns, name string) (*crd.CrdStore, error) {
+	utd, err := config.DynamicClient.Resource(crd.StoreGVR).Namespace(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ins := &crd.CrdStore{}
+	return ins, ins.FromUnstructured(utd)
+}
+
+// readManifests 读取 -f 指定的目录、文件或标准输入(-), 或以 kubectl kustomize 渲染 -k 指定的目录
+func readManifests(filename, kustomize string) ([]json.RawMessage, error) {
+	var data []byte
+	var err error
+	switch {
+	case kustomize != "":
+		cmd := exec.Command("kubectl", "kustomize", kustomize)
+		cmd.Stderr = os.Stderr
+		if data, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("kubectl kustomize %s: %w", kustomize, err)
+		}
+	case filename == "-":
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, err
+		}
+	default:
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return utils.ReadManifestDir(filename)
+		}
+		if data, err = os.ReadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	return utils.SplitManifests(data)
+}
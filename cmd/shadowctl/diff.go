@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// runDiff 以diff子资源比较期望的子资源与集群中的当前对象, 有差异时以退出码1结束, 比较失败时返回错误, 与 kubectl diff 一致.
+// 不指定清单时比较当前版本, 用于发现漂移
+func runDiff(fs *pflag.FlagSet, args []string) error {
+	ns := namespaceFlag(fs)
+	filename := fs.StringP("filename", "f", "", "directory, file or - for stdin to compare, defaults to the revision currently applied")
+	kustomize := fs.StringP("kustomize", "k", "", "kustomization directory rendered with kubectl kustomize")
+	cluster := fs.String("cluster", "", "default target cluster of the children, defaults to the one of the existing shadowresource")
+	name, err := nameArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	shadow := v1.ShadowResource{}
+	shadow.APIVersion = v1.ShadowAPIVersion
+	shadow.Kind = v1.ShadowKind
+	shadow.Name = name
+	shadow.Namespace = *ns
+	if *filename != "" || *kustomize != "" {
+		tasks, err := readManifests(*filename, *kustomize)
+		if err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return fmt.Errorf("no manifests found")
+		}
+		for _, js := range tasks {
+			var item v1.FlowItem
+			if err = json.Unmarshal(js, &item); err != nil {
+				return err
+			}
+			shadow.Spec.FlowList = append(shadow.Spec.FlowList, item)
+		}
+		if shadow.Spec.TargetCluster, err = targetCluster(fs, *ns, name, *cluster); err != nil {
+			return err
+		}
+	}
+	obj, err := utils.ConvertToUnstructured(&shadow)
+	if err != nil {
+		return err
+	}
+	out, err := shadows(*ns).Create(context.TODO(), obj, metav1.CreateOptions{}, "diff")
+	if err != nil {
+		return err
+	}
+	result := &v1.ShadowResourceDiff{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(out.Object, result); err != nil {
+		return err
+	}
+
+	changed, failed := false, 0
+	for _, d := range result.Items {
+		fmt.Printf("=== %s %s\n", d.Action, describeChild(d))
+		switch d.Action {
+		case utils.DiffUnchanged:
+		case utils.DiffFailed:
+			failed++
+			fmt.Printf("error: %s\n", d.Error)
+		default:
+			changed = true
+			fmt.Print(d.Diff)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d children could not be compared", failed)
+	}
+	if changed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// targetCluster 未指定 --cluster 时沿用已有shadow的目标集群
+func targetCluster(fs *pflag.FlagSet, ns, name, cluster string) (string, error) {
+	if fs.Changed("cluster") {
+		return cluster, nil
+	}
+	obj, err := shadows(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return cluster, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "spec", "targetCluster")
+	return current, nil
+}
+
+// describeChild 形如 Deployment default/nginx, 远程集群追加 @cluster
+func describeChild(d v1.ChildDiff) string {
+	s := fmt.Sprintf("%s %s", d.Kind, d.Name)
+	if d.Namespace != "" {
+		s = fmt.Sprintf("%s %s/%s", d.Kind, d.Namespace, d.Name)
+	}
+	if d.Cluster != "" {
+		s += "@" + d.Cluster
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// runExport 输出export子资源返回的shadow, 可以直接提交到其它命名空间或集群
+func runExport(fs *pflag.FlagSet, args []string) error {
+	ns := namespaceFlag(fs)
+	output := fs.StringP("output", "o", "yaml", "output format, yaml or json")
+	manifests := fs.Bool("manifests", false, "print the children as a multi-document yaml instead of a shadowresource")
+	name, err := nameArg(fs, args)
+	if err != nil {
+		return err
+	}
+	obj, err := shadows(*ns).Get(context.TODO(), name, metav1.GetOptions{}, "export")
+	if err != nil {
+		return err
+	}
+	if *manifests {
+		return printManifests(obj)
+	}
+
+	var data []byte
+	switch *output {
+	case "yaml":
+		data, err = yaml.Marshal(obj.Object)
+	case "json":
+		data, err = json.MarshalIndent(obj.Object, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// printManifests 以 --- 分隔输出flowList中的对象, 可以用 kubectl apply -f 或 shadowctl apply -f 提交
+func printManifests(obj *unstructured.Unstructured) error {
+	items, _, err := unstructured.NestedSlice(obj.Object, "spec", "flowList")
+	if err != nil {
+		return err
+	}
+	docs := make([]string, 0, len(items))
+	for _, i := range items {
+		data, err := yaml.Marshal(i)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, string(data))
+	}
+	fmt.Print(strings.Join(docs, "---\n"))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/gc"
+	"github.com/spf13/pflag"
+)
+
+func runGC(fs *pflag.FlagSet, args []string) error {
+	del := fs.Bool("delete", false, "delete the orphaned children instead of only listing them")
+	grace := fs.Duration("grace-period", config.OrphanGracePeriod, "children younger than this are never reported")
+	clientFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := connect(); err != nil {
+		return err
+	}
+
+	orphans, err := gc.Scan(*grace)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Println("no orphaned children found")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tKIND\tNAMESPACE\tNAME\tSHADOW\tREASON")
+	for _, o := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", orNone(o.Cluster), o.Kind, orNone(o.Namespace), o.Name, o.Shadow, o.Reason)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if !*del {
+		return nil
+	}
+	var failed int
+	for _, o := range orphans {
+		if err = gc.Delete(o); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete %s: %s\n", o, err)
+			failed++
+			continue
+		}
+		fmt.Printf("deleted %s\n", o)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orphaned children could not be deleted", failed, len(orphans))
+	}
+	return nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
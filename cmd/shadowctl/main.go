@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(fs *pflag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{name: "tree", usage: "show a shadowresource and the status of its children", run: runTree},
+	{name: "diff", usage: "compare the desired children with the live objects", run: runDiff},
+	{name: "apply", usage: "bundle a directory of manifests into a shadowresource", run: runApply},
+	{name: "rollback", usage: "roll a shadowresource back to an earlier revision", run: runRollback},
+	{name: "export", usage: "print a shadowresource without server generated fields", run: runExport},
+	{name: "clone", usage: "copy a shadowresource into another namespace, renaming its children", run: runClone},
+	{name: "gc", usage: "find children whose shadow no longer exists, and delete them with --delete", run: runGC},
+}
+
+// program 作为kubectl插件(kubectl-shadow)运行时显示为 kubectl shadow
+func program() string {
+	name := filepath.Base(os.Args[0])
+	if strings.HasPrefix(name, "kubectl-") {
+		return "kubectl " + strings.ReplaceAll(strings.TrimPrefix(name, "kubectl-"), "_", "-")
+	}
+	return name
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", program())
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		fs := pflag.NewFlagSet(program()+" "+c.name, pflag.ExitOnError)
+		if err := c.run(fs, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runRollback 回滚到指定版本, 未指定时回滚到当前版本之前最近的一个版本
+func runRollback(fs *pflag.FlagSet, args []string) error {
+	ns := namespaceFlag(fs)
+	to := fs.Int64("to-revision", 0, "revision to roll back to, defaults to the previous revision")
+	name, err := nameArg(fs, args)
+	if err != nil {
+		return err
+	}
+	target := *to
+	if target == 0 {
+		ins, err := getStore(*ns, name)
+		if err != nil {
+			return err
+		}
+		revisions, err := utils.ListRevisions(name, *ns)
+		if err != nil {
+			return err
+		}
+		for _, cr := range revisions {
+			if cr.Revision < ins.Spec.Revision && cr.Revision > target {
+				target = cr.Revision
+			}
+		}
+		if target == 0 {
+			return fmt.Errorf("no revision before %d found for %s/%s", ins.Spec.Revision, *ns, name)
+		}
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"rollbackTo":%d}}`, target))
+	_, err = shadows(*ns).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("shadowresource/%s rolled back to revision %d\n", name, target)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/spf13/pflag"
+	"github.com/tidwall/gjson"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func runTree(fs *pflag.FlagSet, args []string) error {
+	ns := namespaceFlag(fs)
+	name, err := nameArg(fs, args)
+	if err != nil {
+		return err
+	}
+	ins, err := getStore(*ns, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ShadowResource %s/%s  state=%q revision=%d\n", *ns, name, ins.State(), ins.Spec.Revision)
+	for idx, i := range ins.Spec.CrInfoList {
+		branch := "├──"
+		if idx == len(ins.Spec.CrInfoList)-1 {
+			branch = "└──"
+		}
+		fmt.Printf("%s [%d] %s  %s\n", branch, idx, i, childStatus(i))
+	}
+	return nil
+}
+
+// childStatus 读取子资源的状态字段, 未定义状态字段的资源只显示是否存在
+func childStatus(i crd.CrInfo) string {
+	ns := i.Namespace
+	if !i.Namespaced() {
+		ns = ""
+	}
+	utd, err := utils.LiveReader.Get(i.Cluster, i.GVR(), ns, i.Name)
+	if errors.IsNotFound(err) {
+		return "NotFound"
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	key, ok := config.KindStatusKeyMap[i.Kind]
+	if !ok {
+		return "Present"
+	}
+	js, _ := utd.MarshalJSON()
+	return gjson.GetBytes(js, key).String()
+}
@@ -0,0 +1,138 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/initializer"
+	"k8s.io/client-go/informers"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	PluginName = "ShadowResourceLimits"
+	// ConfigMapName 每个命名空间中的限制配置
+	ConfigMapName = "shadowresource-limits"
+	// MaxChildrenKey 一个shadow最多包含的子资源数量
+	MaxChildrenKey = "maxChildren"
+	// AllowedKindsKey 允许的子资源类型, 逗号分隔, 形如 Deployment.apps, 核心组的类型不带组名, 如 ConfigMap
+	AllowedKindsKey = "allowedKinds"
+)
+
+var _ admission.ValidationInterface = &Limits{}
+var _ initializer.WantsExternalKubeInformerFactory = &Limits{}
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName, func(config io.Reader) (admission.Interface, error) {
+		return New(), nil
+	})
+}
+
+// Limits 按命名空间中的 shadowresource-limits ConfigMap 限制shadow的子资源数量和类型,
+// 命名空间中没有该ConfigMap时不做限制
+type Limits struct {
+	*admission.Handler
+	lister listerscorev1.ConfigMapLister
+}
+
+func New() *Limits {
+	return &Limits{
+		Handler: admission.NewHandler(admission.Create, admission.Update),
+	}
+}
+
+func (l *Limits) SetExternalKubeInformerFactory(f informers.SharedInformerFactory) {
+	configMaps := f.Core().V1().ConfigMaps()
+	l.lister = configMaps.Lister()
+	l.SetReadyFunc(configMaps.Informer().HasSynced)
+}
+
+func (l *Limits) ValidateInitialization() error {
+	if l.lister == nil {
+		return fmt.Errorf("%s requires a configmap lister", PluginName)
+	}
+	return nil
+}
+
+func (l *Limits) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	if a.GetResource().GroupResource() != v1.SchemeGroupResource || a.GetSubresource() != "" {
+		return nil
+	}
+	shadow, ok := a.GetObject().(*v1.ShadowResource)
+	if !ok {
+		return nil
+	}
+	if !l.WaitForReady() {
+		return admission.NewForbidden(a, fmt.Errorf("not yet ready to handle request"))
+	}
+	cm, err := l.lister.ConfigMaps(a.GetNamespace()).Get(ConfigMapName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	flowList, paths := children(shadow, a.GetNamespace())
+
+	if str, ok := cm.Data[MaxChildrenKey]; ok {
+		limit, err := strconv.Atoi(str)
+		if err != nil {
+			return apierrors.NewInternalError(fmt.Errorf("invalid %s in %s/%s: %w", MaxChildrenKey, a.GetNamespace(), ConfigMapName, err))
+		}
+		if n := len(flowList); n > limit {
+			return admission.NewForbidden(a, fmt.Errorf("%d children exceed the limit of %d in namespace %s", n, limit, a.GetNamespace()))
+		}
+	}
+
+	if str, ok := cm.Data[AllowedKindsKey]; ok {
+		allowed := make(map[schema.GroupKind]bool)
+		for _, kind := range strings.Split(str, ",") {
+			allowed[schema.ParseGroupKind(strings.TrimSpace(kind))] = true
+		}
+		for idx, item := range flowList {
+			apiVersion, _ := item.Object["apiVersion"].(string)
+			kind, _ := item.Object["kind"].(string)
+			gv, _ := schema.ParseGroupVersion(apiVersion)
+			gk := gv.WithKind(kind).GroupKind()
+			if allowed[gk] {
+				continue
+			}
+			return admission.NewForbidden(a, fmt.Errorf("%s: kind %q is not allowed in namespace %s", paths[idx], gk, a.GetNamespace()))
+		}
+	}
+	return nil
+}
+
+// children 返回提交时实际使用的子资源及其在请求中的位置. rollbackTo 指向的版本与 source 中的资源
+// 同样计入限制, 读取失败时由创建流程报告
+func children(shadow *v1.ShadowResource, ns string) (items []v1.FlowItem, paths []string) {
+	if shadow.Spec.RollbackTo != nil {
+		revision, _ := utils.GetRevision(shadow.Name, ns, *shadow.Spec.RollbackTo)
+		for idx, item := range revision {
+			items = append(items, item)
+			paths = append(paths, fmt.Sprintf("spec.rollbackTo revision %d item %d", *shadow.Spec.RollbackTo, idx))
+		}
+	} else {
+		for idx, item := range shadow.Spec.FlowList {
+			items = append(items, item)
+			paths = append(paths, fmt.Sprintf("spec.flowList[%d]", idx))
+		}
+	}
+	if shadow.Spec.Source != nil {
+		expanded, _ := utils.ExpandSource(shadow.Spec.Source, ns)
+		for idx, item := range expanded {
+			items = append(items, item)
+			paths = append(paths, fmt.Sprintf("spec.source item %d", idx))
+		}
+	}
+	return items, paths
+}
@@ -0,0 +1,66 @@
+package limits
+
+import (
+	"context"
+	"testing"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newLimits(t *testing.T, data map[string]string) *Limits {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: "default"}, Data: data}
+	if err := indexer.Add(cm); err != nil {
+		t.Fatal(err)
+	}
+	l := New()
+	l.lister = listerscorev1.NewConfigMapLister(indexer)
+	l.SetReadyFunc(func() bool { return true })
+	return l
+}
+
+func attributes(shadow *v1.ShadowResource) admission.Attributes {
+	return admission.NewAttributesRecord(shadow, nil, v1.SchemeGroupVersion.WithKind(v1.ShadowKind), "default", shadow.Name,
+		v1.SchemeGroupVersion.WithResource(v1.SchemeGroupResource.Resource), "", admission.Create, &metav1.CreateOptions{}, false, nil)
+}
+
+func shadowOf(objs ...map[string]interface{}) *v1.ShadowResource {
+	shadow := &v1.ShadowResource{}
+	shadow.Name = "web"
+	shadow.Namespace = "default"
+	for _, obj := range objs {
+		shadow.Spec.FlowList = append(shadow.Spec.FlowList, v1.FlowItem{Object: obj})
+	}
+	return shadow
+}
+
+func TestValidate(t *testing.T) {
+	deployment := map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment"}
+	configMap := map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}
+	custom := map[string]interface{}{"apiVersion": "example.com/v1", "kind": "Deployment"}
+	tests := []struct {
+		name    string
+		data    map[string]string
+		shadow  *v1.ShadowResource
+		wantErr bool
+	}{
+		{name: "allowed", data: map[string]string{AllowedKindsKey: "Deployment.apps, ConfigMap"}, shadow: shadowOf(deployment, configMap)},
+		{name: "other group", data: map[string]string{AllowedKindsKey: "Deployment.apps"}, shadow: shadowOf(custom), wantErr: true},
+		{name: "bare kind", data: map[string]string{AllowedKindsKey: "Deployment"}, shadow: shadowOf(deployment), wantErr: true},
+		{name: "core group", data: map[string]string{AllowedKindsKey: "ConfigMap"}, shadow: shadowOf(configMap)},
+		{name: "max children", data: map[string]string{MaxChildrenKey: "1"}, shadow: shadowOf(deployment, configMap), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newLimits(t, tt.data).Validate(context.TODO(), attributes(tt.shadow), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
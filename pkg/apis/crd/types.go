@@ -2,6 +2,9 @@ package crd
 
 import (
 	"encoding/json"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -10,7 +13,14 @@ import (
 const (
 	StoreApiVersion = "kubesphere.io/v1"
 	StoreKind       = "shim"
-	StoreStatusKey  = "spec.status"
+	StoreStatusKey  = "status.state"
+	// StateSuspended 设置了 spec.suspend 的shadow的状态, 暂停期间不随子资源变化
+	StateSuspended = "Suspended"
+)
+
+const (
+	ScopeNamespaced = "Namespaced"
+	ScopeCluster    = "Cluster"
 )
 
 var StoreGVR = schema.GroupVersionResource{
@@ -21,23 +31,80 @@ var StoreGVR = schema.GroupVersionResource{
 
 type CrdStoreSpec struct {
 	CrInfoList []CrInfo `json:"CrInfoList"`
-	Status     string   `json:"status"`
-	ShadowUid  string   `json:"shadowUid"`
+	// Status 旧版本写在spec中的状态, 只读, 新状态见 CrdStore.Status
+	Status    string `json:"status,omitempty"`
+	ShadowUid string `json:"shadowUid"`
+	Revision  int64  `json:"revision"`
+	// TargetCluster shadow的默认目标集群
+	TargetCluster string `json:"targetCluster,omitempty"`
+	// ManagedFields shadow的字段归属, 供server-side apply计算冲突
+	ManagedFields []metav1.ManagedFieldsEntry `json:"managedFields,omitempty"`
+	// Suspend 对应shadow的 spec.suspend
+	Suspend bool `json:"suspend,omitempty"`
+	// Suspended 暂停时被改写的子资源及其原始值, 恢复后清空
+	Suspended []SuspendedChild `json:"suspended,omitempty"`
+	// Source 对应shadow的 spec.source, 每次提交时重新读取
+	Source *v1.FlowSource `json:"source,omitempty"`
+	// SourceItems CrInfoList末尾由source展开的子资源数量, 不出现在详情的flowList中
+	SourceItems int `json:"sourceItems,omitempty"`
+}
+
+// SuspendedChild 暂停前子资源的原始值, 为空表示原来未设置, 恢复时由服务端补全默认值
+type SuspendedChild struct {
+	CrInfo   `json:",inline"`
+	Replicas *int64 `json:"replicas,omitempty"`
+	Suspend  *bool  `json:"suspend,omitempty"`
 }
 
 type CrInfo struct {
+	Cluster   string `json:"cluster,omitempty"`
 	Group     string `json:"group"`
 	Version   string `json:"version"`
 	Kind      string `json:"kind"`
 	Resource  string `json:"resource"`
 	Namespace string `json:"namespace"`
 	Name      string `json:"name"`
+	// Scope Namespaced 或 Cluster, 旧记录为空时按Namespaced处理
+	Scope string `json:"scope,omitempty"`
 }
 
 type CrdStore struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
-	Spec              CrdStoreSpec `json:"spec"`
+	Spec              CrdStoreSpec    `json:"spec"`
+	Status            *CrdStoreStatus `json:"status,omitempty"`
+}
+
+// CrdStoreStatus 通过status子资源以server-side apply写入, 不影响generation
+type CrdStoreStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime 最近一次状态变更的时间
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// StatusApply 提交到status子资源的apply配置, 只包含定位shim所需的字段与状态
+type StatusApply struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Status            CrdStoreStatus `json:"status"`
+}
+
+// NewStatusApply 生成shim状态的apply配置
+func NewStatusApply(ns, name string, status CrdStoreStatus) StatusApply {
+	return StatusApply{
+		TypeMeta:   metav1.TypeMeta{APIVersion: StoreApiVersion, Kind: StoreKind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+		Status:     status,
+	}
+}
+
+// State 返回shadow的状态, 兼容旧版本写在spec中的状态
+func (u *CrdStore) State() string {
+	if u.Status != nil && u.Status.State != "" {
+		return u.Status.State
+	}
+	return u.Spec.Status
 }
 
 func (u *CrdStore) FromUnstructured(utd *unstructured.Unstructured) (err error) {
@@ -53,3 +120,27 @@ type Metadata struct {
 	Name      string
 	Namespace string
 }
+
+// String 形如 Deployment default/nginx, 远程集群追加 @cluster
+func (i CrInfo) String() string {
+	s := fmt.Sprintf("%s %s", i.Kind, i.Name)
+	if i.Namespaced() {
+		s = fmt.Sprintf("%s %s/%s", i.Kind, i.Namespace, i.Name)
+	}
+	if i.Cluster != "" {
+		s += "@" + i.Cluster
+	}
+	return s
+}
+
+func (i CrInfo) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    i.Group,
+		Version:  i.Version,
+		Resource: i.Resource,
+	}
+}
+
+func (i CrInfo) Namespaced() bool {
+	return i.Scope != ScopeCluster
+}
@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+// FlowItem is a complete Kubernetes object applied as a child of the ShadowResource,
+// it is serialized as the bare object
+type FlowItem struct {
+	Object map[string]interface{} `json:"-"`
+}
+
+func (in FlowItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(in.Object)
+}
+
+func (in *FlowItem) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &in.Object)
+}
+
+// DeepCopyInto is written by hand because FlowItem holds arbitrary JSON values
+func (in *FlowItem) DeepCopyInto(out *FlowItem) {
+	if in.Object != nil {
+		out.Object = runtime.DeepCopyJSON(in.Object)
+	}
+}
+
+func (in *FlowItem) DeepCopy() *FlowItem {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowItem)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// OpenAPIDefinition marks flowList items as embedded objects so kubectl explain and
+// server-side apply keep their unknown fields
+func (FlowItem) OpenAPIDefinition() common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "FlowItem is a complete Kubernetes object applied as a child of the ShadowResource",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion of the child object",
+							Type:        []string{"string"},
+						},
+					},
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind of the child object",
+							Type:        []string{"string"},
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Standard object metadata of the child, the namespace defaults to the namespace of the ShadowResource",
+							Type:        []string{"object"},
+						},
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-preserve-unknown-fields": true,
+							},
+						},
+					},
+				},
+				Required: []string{"apiVersion", "kind", "metadata"},
+			},
+			VendorExtensible: spec.VendorExtensible{
+				Extensions: spec.Extensions{
+					"x-kubernetes-embedded-resource":       true,
+					"x-kubernetes-preserve-unknown-fields": true,
+				},
+			},
+		},
+	}
+}
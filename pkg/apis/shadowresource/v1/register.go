@@ -13,12 +13,21 @@ const (
 	ShadowAPIVersion   = "apis.abc.com/v1"
 	ShadowKind         = "ShadowResource"
 	FieldManager       = "shadow"
+	ShadowNameLabel    = "apis.abc.com/shadow-name"
+	ShadowNSLabel      = "apis.abc.com/shadow-namespace"
+	ShadowUIDLabel     = "apis.abc.com/shadow-uid"
+	RevisionHashLabel  = "apis.abc.com/revision-hash"
+	WaveAnnotation     = "apis.abc.com/wave"
+	ClusterAnnotation  = "apis.abc.com/target-cluster"
 )
 
 // SchemeGroupVersion is group version used to register these objects
 var SchemeGroupVersion = schema.GroupVersion{Group: ShadowApiGroup, Version: ShadowApiVersion}
 var SchemeGroupResource = schema.GroupResource{Group: ShadowApiGroup, Resource: ShadowResourceName}
 
+// ShadowGVR is used to access ShadowResources through the aggregated api
+var ShadowGVR = SchemeGroupVersion.WithResource(ShadowResourceName)
+
 var (
 	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
 	AddToScheme   = SchemeBuilder.AddToScheme
@@ -28,6 +37,7 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&ShadowResource{},
 		&ShadowResourceList{},
+		&ShadowResourceDiff{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
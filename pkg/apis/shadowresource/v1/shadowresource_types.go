@@ -25,7 +25,42 @@ import (
 
 // ShadowResourceSpec defines the desired state of ShadowResource
 type ShadowResourceSpec struct {
-	FlowList []interface{} `json:"flowList"`
+	// FlowList holds the children to apply, in order
+	// +listType=atomic
+	// +optional
+	FlowList []FlowItem `json:"flowList,omitempty"`
+	// Source adds the children read from a ConfigMap or a yaml blob after the flowList.
+	// It is read again on every apply, the children it adds are not listed in flowList
+	// +optional
+	Source *FlowSource `json:"source,omitempty"`
+	// RollbackTo re-applies the flowList recorded in the given revision
+	RollbackTo *int64 `json:"rollbackTo,omitempty"`
+	// TargetCluster is the registered cluster items are applied to unless they set the
+	// apis.abc.com/target-cluster annotation, empty means the cluster the server runs in
+	TargetCluster string `json:"targetCluster,omitempty"`
+	// Adopt takes ownership of children that already exist instead of creating them.
+	// The children are only labelled, a flowList that would change them is rejected
+	Adopt bool `json:"adopt,omitempty"`
+	// Suspend scales Deployments and StatefulSets to zero and suspends Jobs and CronJobs.
+	// The original values are restored when it is unset
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// FlowSource is decoded into flowList items when the ShadowResource is applied,
+// documents may be separated with --- and kind: List documents are flattened
+type FlowSource struct {
+	// ConfigMap reads the manifests from a ConfigMap in the namespace of the ShadowResource
+	ConfigMap *ConfigMapSource `json:"configMap,omitempty"`
+	// Manifests is a yaml or json blob, e.g. the output of kustomize build or helm template
+	Manifests string `json:"manifests,omitempty"`
+}
+
+// ConfigMapSource selects the keys of a ConfigMap holding manifests
+type ConfigMapSource struct {
+	Name string `json:"name"`
+	// Keys are read in the given order, all keys are read in sorted order when empty
+	Keys []string `json:"keys,omitempty"`
 }
 
 // ShadowResourceStatus defines the observed state of ShadowResource
@@ -33,6 +68,36 @@ type ShadowResourceStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	State string `json:"State"`
+	// Message explains the current State
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is when State last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Revision is the revision of the flowList currently applied
+	Revision int64 `json:"revision,omitempty"`
+	// ChildErrors lists the children that could not be read
+	ChildErrors []ChildError `json:"childErrors,omitempty"`
+	// Clusters summarizes the children per target cluster, only set when a child is
+	// deployed outside the local cluster
+	Clusters []ClusterStatus `json:"clusters,omitempty"`
+}
+
+// ClusterStatus summarizes the children deployed to one cluster
+type ClusterStatus struct {
+	Name     string `json:"name"`
+	Children int    `json:"children"`
+	Failed   int    `json:"failed"`
+}
+
+// ChildError describes a flowList item that failed
+type ChildError struct {
+	// Index is the position of the item in spec.flowList. The item holds the object
+	// recorded in the current revision instead of the live object
+	Index     int    `json:"index"`
+	Cluster   string `json:"cluster,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
 }
 
 //+kubebuilder:object:root=true
@@ -55,3 +120,32 @@ type ShadowResourceList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []ShadowResource `json:"items"`
 }
+
+//+kubebuilder:object:root=true
+
+// ShadowResourceDiff is returned by the diff subresource, it lists what applying the
+// posted ShadowResource would change without modifying the cluster
+type ShadowResourceDiff struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Items holds one entry per child, including the children that would be pruned
+	// +listType=atomic
+	Items []ChildDiff `json:"items"`
+}
+
+// ChildDiff describes the change to a single child
+type ChildDiff struct {
+	// Action is one of Create, Update, Unchanged, Prune or Failed
+	Action     string `json:"action"`
+	Cluster    string `json:"cluster,omitempty"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Diff is a unified diff from the live object to the dry-run result, server
+	// populated fields are left out. Empty when Action is Unchanged
+	Diff string `json:"diff,omitempty"`
+	// Error is why the child could not be compared, set when Action is Failed
+	Error string `json:"error,omitempty"`
+}
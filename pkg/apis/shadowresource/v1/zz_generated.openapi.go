@@ -8,14 +8,21 @@
 package v1
 
 import (
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	common "k8s.io/kube-openapi/pkg/common"
 	spec "k8s.io/kube-openapi/pkg/validation/spec"
 )
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ChildDiff":            schema_pkg_apis_shadowresource_v1_ChildDiff(ref),
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ChildError":           schema_pkg_apis_shadowresource_v1_ChildError(ref),
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ClusterStatus":        schema_pkg_apis_shadowresource_v1_ClusterStatus(ref),
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ConfigMapSource":      schema_pkg_apis_shadowresource_v1_ConfigMapSource(ref),
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.FlowItem":             FlowItem{}.OpenAPIDefinition(),
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.FlowSource":           schema_pkg_apis_shadowresource_v1_FlowSource(ref),
 		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ShadowResource":       schema_pkg_apis_shadowresource_v1_ShadowResource(ref),
+		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ShadowResourceDiff":   schema_pkg_apis_shadowresource_v1_ShadowResourceDiff(ref),
 		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ShadowResourceList":   schema_pkg_apis_shadowresource_v1_ShadowResourceList(ref),
 		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ShadowResourceSpec":   schema_pkg_apis_shadowresource_v1_ShadowResourceSpec(ref),
 		"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ShadowResourceStatus": schema_pkg_apis_shadowresource_v1_ShadowResourceStatus(ref),
@@ -74,6 +81,229 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 	}
 }
 
+func schema_pkg_apis_shadowresource_v1_ChildDiff(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ChildDiff describes the change to a single child",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"action": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Action is one of Create, Update, Unchanged, Prune or Failed",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"cluster": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"namespace": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"diff": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Diff is a unified diff from the live object to the dry-run result, server populated fields are left out. Empty when Action is Unchanged",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"error": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Error is why the child could not be compared, set when Action is Failed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"action", "apiVersion", "kind", "name"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_shadowresource_v1_ChildError(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ChildError describes a flowList item that failed",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"index": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Index is the position of the item in spec.flowList. The item holds the object recorded in the current revision instead of the live object",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"cluster": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"namespace": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+				},
+				Required: []string{"index", "kind", "name", "message"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_shadowresource_v1_ClusterStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterStatus summarizes the children deployed to one cluster",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"children": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int32",
+						},
+					},
+					"failed": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int32",
+						},
+					},
+				},
+				Required: []string{"name", "children", "failed"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_shadowresource_v1_ConfigMapSource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ConfigMapSource selects the keys of a ConfigMap holding manifests",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"keys": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Keys are read in the given order, all keys are read in sorted order when empty",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"name"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_shadowresource_v1_FlowSource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "FlowSource is decoded into flowList items when the ShadowResource is applied, documents may be separated with --- and kind: List documents are flattened",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"configMap": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConfigMap reads the manifests from a ConfigMap in the namespace of the ShadowResource",
+							Ref:         ref("github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ConfigMapSource"),
+						},
+					},
+					"manifests": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Manifests is a yaml or json blob, e.g. the output of kustomize build or helm template",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ConfigMapSource"},
+	}
+}
+
 func schema_pkg_apis_shadowresource_v1_ShadowResource(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -121,6 +351,61 @@ func schema_pkg_apis_shadowresource_v1_ShadowResource(ref common.ReferenceCallba
 	}
 }
 
+func schema_pkg_apis_shadowresource_v1_ShadowResourceDiff(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ShadowResourceDiff is returned by the diff subresource, it lists what applying the posted ShadowResource would change without modifying the cluster",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"items": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-type": "atomic",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "Items holds one entry per child, including the children that would be pruned",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ChildDiff"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ChildDiff", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
 func schema_pkg_apis_shadowresource_v1_ShadowResourceList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -178,22 +463,63 @@ func schema_pkg_apis_shadowresource_v1_ShadowResourceSpec(ref common.ReferenceCa
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
 					"flowList": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-type": "atomic",
+							},
+						},
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
+							Description: "FlowList holds the children to apply, in order",
+							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
-										Type:   []string{"object"},
-										Format: "",
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.FlowItem"),
 									},
 								},
 							},
 						},
 					},
+					"source": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Source adds the children read from a ConfigMap or a yaml blob after the flowList. It is read again on every apply, the children it adds are not listed in flowList",
+							Ref:         ref("github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.FlowSource"),
+						},
+					},
+					"rollbackTo": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RollbackTo re-applies the flowList recorded in the given revision",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"targetCluster": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetCluster is the registered cluster items are applied to unless they set the apis.abc.com/target-cluster annotation, empty means the cluster the server runs in",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"adopt": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Adopt takes ownership of children that already exist instead of creating them. The children are only labelled, a flowList that would change them is rejected",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"suspend": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Suspend scales Deployments and StatefulSets to zero and suspends Jobs and CronJobs. The original values are restored when it is unset",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 				},
-				Required: []string{"flowList"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.FlowItem", "github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.FlowSource"},
 	}
 }
 
@@ -212,10 +538,61 @@ func schema_pkg_apis_shadowresource_v1_ShadowResourceStatus(ref common.Reference
 							Format:      "",
 						},
 					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message explains the current State",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastTransitionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastTransitionTime is when State last changed",
+							Default:     map[string]interface{}{},
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"revision": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Revision is the revision of the flowList currently applied",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"childErrors": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ChildErrors lists the children that could not be read",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ChildError"),
+									},
+								},
+							},
+						},
+					},
+					"clusters": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Clusters summarizes the children per target cluster, only set when a child is deployed outside the local cluster",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ClusterStatus"),
+									},
+								},
+							},
+						},
+					},
 				},
 				Required: []string{"State"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ChildError", "github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1.ClusterStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
@@ -812,8 +1189,8 @@ func schema_pkg_apis_meta_v1_Duration(ref common.ReferenceCallback) common.OpenA
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Description: "Duration is a wrapper around time.Duration which supports correct marshaling to YAML and JSON. In particular, it marshals into strings, which can be used as map keys in json.",
-				Type:        v1.Duration{}.OpenAPISchemaType(),
-				Format:      v1.Duration{}.OpenAPISchemaFormat(),
+				Type:        metav1.Duration{}.OpenAPISchemaType(),
+				Format:      metav1.Duration{}.OpenAPISchemaFormat(),
 			},
 		},
 	}
@@ -1427,8 +1804,8 @@ func schema_pkg_apis_meta_v1_MicroTime(ref common.ReferenceCallback) common.Open
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Description: "MicroTime is version of Time with microsecond level precision.",
-				Type:        v1.MicroTime{}.OpenAPISchemaType(),
-				Format:      v1.MicroTime{}.OpenAPISchemaFormat(),
+				Type:        metav1.MicroTime{}.OpenAPISchemaType(),
+				Format:      metav1.MicroTime{}.OpenAPISchemaFormat(),
 			},
 		},
 	}
@@ -2344,8 +2721,8 @@ func schema_pkg_apis_meta_v1_Time(ref common.ReferenceCallback) common.OpenAPIDe
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Description: "Time is a wrapper around time.Time which supports correct marshaling to YAML and JSON.  Wrappers are provided for many of the factory methods that the time package offers.",
-				Type:        v1.Time{}.OpenAPISchemaType(),
-				Format:      v1.Time{}.OpenAPISchemaFormat(),
+				Type:        metav1.Time{}.OpenAPISchemaType(),
+				Format:      metav1.Time{}.OpenAPISchemaFormat(),
 			},
 		},
 	}
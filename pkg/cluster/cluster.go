@@ -0,0 +1,202 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/phuslu/log"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// Local 为空表示服务所在的集群
+	Local = ""
+	// Label 带有该标签的Secret会被注册为集群, Secret名即集群名
+	Label = "apis.abc.com/cluster"
+	// KubeconfigKey Secret中保存kubeconfig的key
+	KubeconfigKey = "kubeconfig"
+)
+
+// Client 访问某个集群所需的客户端
+type Client struct {
+	Name      string
+	Dynamic   dynamic.Interface
+	Mapper    meta.RESTMapper
+	Discovery discovery.DiscoveryInterface
+	// version 创建客户端时Secret的resourceVersion
+	version string
+}
+
+func (c *Client) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return c.Dynamic.Resource(gvr)
+}
+
+var (
+	mu      sync.Mutex
+	local   *Client
+	clients = make(map[string]*Client)
+	lister  listerscorev1.SecretLister
+	// building 正在创建的集群客户端
+	building singleflight.Group
+)
+
+func selector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{Label: "true"})
+}
+
+// SetLocal 设置服务所在集群的客户端
+func SetLocal(client dynamic.Interface, mapper meta.RESTMapper, dc discovery.DiscoveryInterface) {
+	mu.Lock()
+	defer mu.Unlock()
+	local = &Client{Name: Local, Dynamic: client, Mapper: mapper, Discovery: dc}
+}
+
+// Names 返回所有已注册的集群名, 不含本集群
+func Names() ([]string, error) {
+	mu.Lock()
+	l := lister
+	mu.Unlock()
+
+	var names []string
+	if l != nil {
+		secrets, err := l.Secrets(config.ClusterNamespace).List(selector())
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range secrets {
+			names = append(names, s.Name)
+		}
+		return names, nil
+	}
+	list, err := config.K8sClient.CoreV1().Secrets(config.ClusterNamespace).
+		List(context.TODO(), metav1.ListOptions{LabelSelector: selector().String()})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range list.Items {
+		names = append(names, s.Name)
+	}
+	return names, nil
+}
+
+// Start 监听 config.ClusterNamespace 下的集群Secret, 未调用时每次都直接读取Secret
+func Start(stopCh <-chan struct{}) {
+	factory := informers.NewSharedInformerFactoryWithOptions(config.K8sClient, 0,
+		informers.WithNamespace(config.ClusterNamespace),
+		informers.WithTweakListOptions(func(opt *metav1.ListOptions) {
+			opt.LabelSelector = selector().String()
+		}))
+	secrets := factory.Core().V1().Secrets()
+	secrets.Informer()
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+	mu.Lock()
+	lister = secrets.Lister()
+	mu.Unlock()
+	log.Info().Msgf("集群注册表载入完成")
+}
+
+// Get 返回集群的客户端, Secret更新后会重新创建
+func Get(name string) (*Client, error) {
+	if name == Local {
+		mu.Lock()
+		defer mu.Unlock()
+		if local == nil {
+			return nil, fmt.Errorf("local cluster is not initialized")
+		}
+		return local, nil
+	}
+
+	secret, err := getSecret(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	c, ok := clients[name]
+	mu.Unlock()
+	if ok && c.version == secret.ResourceVersion {
+		return c, nil
+	}
+	// 创建客户端需要访问该集群做discovery, 不持有锁, 同一集群的并发请求只创建一次
+	v, err, _ := building.Do(name+"/"+secret.ResourceVersion, func() (interface{}, error) {
+		c, err := newClient(secret)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		clients[name] = c
+		mu.Unlock()
+		log.Info().Msgf("创建集群客户端: %s", name)
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Client), nil
+}
+
+func getSecret(name string) (*corev1.Secret, error) {
+	mu.Lock()
+	l := lister
+	mu.Unlock()
+
+	var secret *corev1.Secret
+	var err error
+	if l != nil {
+		secret, err = l.Secrets(config.ClusterNamespace).Get(name)
+	} else {
+		secret, err = config.K8sClient.CoreV1().Secrets(config.ClusterNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q is not registered: %w", name, err)
+	}
+	if !selector().Matches(labels.Set(secret.Labels)) {
+		return nil, fmt.Errorf("cluster %q is not registered: secret %s/%s has no %s=true label",
+			name, config.ClusterNamespace, name, Label)
+	}
+	return secret, nil
+}
+
+func newClient(secret *corev1.Secret) (*Client, error) {
+	kubeconfig, ok := secret.Data[KubeconfigKey]
+	if !ok {
+		return nil, fmt.Errorf("cluster %q: secret has no %q key", secret.Name, KubeconfigKey)
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %w", secret.Name, err)
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	gr, err := restmapper.GetAPIGroupResources(dc)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %w", secret.Name, err)
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Name:      secret.Name,
+		Dynamic:   client,
+		Mapper:    restmapper.NewDiscoveryRESTMapper(gr),
+		Discovery: dc,
+		version:   secret.ResourceVersion,
+	}, nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/phuslu/log"
 
 	"k8s.io/client-go/dynamic"
@@ -8,6 +10,8 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 func init() {
@@ -26,21 +30,78 @@ func init() {
 }
 
 var DynamicClient dynamic.Interface
-var K8sClient *kubernetes.Clientset
-var KindStatusKeyMap map[string]string
+var K8sClient kubernetes.Interface
+var KindStatusKeyMap = map[string]string{"Pod": "status.phase"}
 
-func init() {
-	var err error
-	DynamicClient, err = dynamic.NewForConfig(K8sRestConfig())
-	if err != nil {
-		log.Fatal()
+// clientConfig Init 使用的kubeconfig, 用于取得当前context的命名空间
+var clientConfig clientcmd.ClientConfig
+
+// LiveReadOnEmptyRV 为true时 resourceVersion="" 的读请求不走informer缓存
+var LiveReadOnEmptyRV bool
+
+// FetchWorkers 获取shadow详情时并发读取子资源的数量
+var FetchWorkers = 8
+
+// ApplyWorkers 同一wave内并发提交子资源的数量
+var ApplyWorkers = 4
+
+// ClusterNamespace 保存集群kubeconfig Secret的命名空间
+var ClusterNamespace = "shadow-system"
+
+// CrossNamespacePolicy 允许跨命名空间创建子资源的规则, 格式为 shadow命名空间:子资源命名空间
+var CrossNamespacePolicy []string
+
+// ClusterScopedNamespaces 允许创建集群级别子资源的shadow命名空间
+var ClusterScopedNamespaces []string
+
+// LeaderElect 为true时后台任务(状态同步等)只在选举出的leader上运行, 所有副本都提供api服务
+var LeaderElect bool
+
+// LeaderElectNamespace 选举使用的Lease所在命名空间
+var LeaderElectNamespace = "shadow-system"
+
+// OrphanScanInterval 孤儿子资源的扫描间隔, 为0时不扫描
+var OrphanScanInterval = 10 * time.Minute
+
+// OrphanGracePeriod 创建时间不足该时长的子资源可能还在提交中, 不视为孤儿
+var OrphanGracePeriod = 10 * time.Minute
+
+// OrphanDelete 为true时删除扫描到的孤儿子资源, 否则只记录日志
+var OrphanDelete bool
+
+// Init 按kubeconfig与context创建客户端, kubeconfig为空时依次使用 KUBECONFIG、~/.kube/config 与集群内配置.
+// 客户端在启动参数解析后创建, 单元测试可以不调用它或直接替换客户端
+func Init(kubeconfig, context string) error {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig == "" {
+		kubeconfig = KubeconfigPath()
 	}
-	K8sClient, err = kubernetes.NewForConfig(K8sRestConfig())
+	rules.ExplicitPath = kubeconfig
+	clientConfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: context})
+	restConfig, err := K8sRestConfig()
 	if err != nil {
-		log.Fatal()
+		return err
+	}
+	if DynamicClient, err = dynamic.NewForConfig(restConfig); err != nil {
+		return fmt.Errorf("create dynamic client: %w", err)
+	}
+	if K8sClient, err = kubernetes.NewForConfig(restConfig); err != nil {
+		return fmt.Errorf("create kubernetes client: %w", err)
+	}
+	return nil
+}
+
+// Namespace 返回kubeconfig当前context的命名空间, 未设置时为default
+func Namespace() string {
+	if clientConfig == nil {
+		return "default"
+	}
+	ns, _, err := clientConfig.Namespace()
+	if err != nil || ns == "" {
+		return "default"
 	}
-	KindStatusKeyMap = make(map[string]string)
-	KindStatusKeyMap["Pod"] = "status.phase"
+	return ns
 }
 
 func GetStatusKey(kind string) string {
@@ -51,19 +112,35 @@ func GetStatusKey(kind string) string {
 	return key
 }
 
-func K8sRestConfig() *rest.Config {
+// KubeconfigPath 优先使用 KUBECONFIG 中的第一个文件, 其次是 ~/.kube/config, 都不存在时为空表示使用集群内配置
+func KubeconfigPath() string {
+	for _, path := range filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar)) {
+		if path != "" && exists(path) {
+			return path
+		}
+	}
 	if exists(clientcmd.RecommendedHomeFile) {
-		config, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
-		if err != nil {
-			log.Fatal()
+		return clientcmd.RecommendedHomeFile
+	}
+	return ""
+}
+
+// K8sRestConfig 返回 Init 选定的kubeconfig对应的配置, 没有kubeconfig时使用集群内配置
+func K8sRestConfig() (*rest.Config, error) {
+	if clientConfig != nil {
+		config, err := clientConfig.ClientConfig()
+		if err == nil {
+			return config, nil
+		}
+		if !clientcmd.IsEmptyConfig(err) {
+			return nil, fmt.Errorf("load kubeconfig: %w", err)
 		}
-		return config
 	}
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		log.Fatal()
+		return nil, fmt.Errorf("no kubeconfig found and in-cluster config failed: %w", err)
 	}
-	return config
+	return config, nil
 }
 
 func exists(path string) bool {
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/phuslu/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const component = "shadowresource"
+
+const (
+	ReasonApplied       = "Applied"
+	ReasonApplyFailed   = "ApplyFailed"
+	ReasonDeleted       = "Deleted"
+	ReasonDeleteFailed  = "DeleteFailed"
+	ReasonPruned        = "Pruned"
+	ReasonStatusChanged = "StatusChanged"
+	ReasonSuspended     = "Suspended"
+	ReasonResumed       = "Resumed"
+)
+
+var recorder record.EventRecorder
+
+// Start 启动事件广播, 未启动时记录事件为空操作
+func Start(stopCh <-chan struct{}) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: config.K8sClient.CoreV1().Events("")})
+	recorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+	log.Info().Msgf("启动事件记录 完成")
+}
+
+// ShadowRef 事件关联的shadow, uid与shim中记录的shadowUid一致, kubectl describe按它过滤事件
+func ShadowRef(ns, name string, uid types.UID) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: v1.ShadowAPIVersion,
+		Kind:       v1.ShadowKind,
+		Namespace:  ns,
+		Name:       name,
+		UID:        uid,
+	}
+}
+
+func Normal(ref *corev1.ObjectReference, reason, messageFmt string, args ...interface{}) {
+	emit(ref, corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+func Warning(ref *corev1.ObjectReference, reason, messageFmt string, args ...interface{}) {
+	emit(ref, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+func emit(ref *corev1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil || ref == nil || ref.Name == "" {
+		return
+	}
+	recorder.Event(ref, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
@@ -0,0 +1,236 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/leader"
+	"github.com/inksnw/shadowresource/pkg/metrics"
+	"github.com/phuslu/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+)
+
+// Orphan 带有shadow标签, 但所属shadow已不存在或没有记录它的子资源
+type Orphan struct {
+	Cluster   string
+	GVR       schema.GroupVersionResource
+	Kind      string
+	Namespace string
+	Name      string
+	UID       types.UID
+	// Shadow 标签中记录的shadow, 形如 namespace/name
+	Shadow string
+	Reason string
+}
+
+func (o Orphan) String() string {
+	info := crd.CrInfo{Cluster: o.Cluster, Kind: o.Kind, Namespace: o.Namespace, Name: o.Name, Scope: crd.ScopeNamespaced}
+	if o.Namespace == "" {
+		info.Scope = crd.ScopeCluster
+	}
+	return info.String()
+}
+
+func childKey(cluster, group, kind, ns, name string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", cluster, group, kind, ns, name)
+}
+
+// Scan 在本集群与所有已注册集群中查找孤儿子资源, 创建时间不足grace的资源可能还在提交中, 不做判断
+func Scan(grace time.Duration) ([]Orphan, error) {
+	list, err := config.DynamicClient.Resource(crd.StoreGVR).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[string]string)
+	recorded := sets.NewString()
+	for _, i := range list.Items {
+		ins := &crd.CrdStore{}
+		if err = ins.FromUnstructured(&i); err != nil {
+			return nil, err
+		}
+		uids[ins.Namespace+"/"+ins.Name] = ins.Spec.ShadowUid
+		for _, c := range ins.Spec.CrInfoList {
+			ns := c.Namespace
+			if !c.Namespaced() {
+				ns = ""
+			}
+			recorded.Insert(childKey(c.Cluster, c.Group, c.Kind, ns, c.Name))
+		}
+	}
+
+	names, err := cluster.Names()
+	if err != nil {
+		return nil, err
+	}
+	var orphans []Orphan
+	for _, name := range append([]string{cluster.Local}, names...) {
+		found, err := scanCluster(name, grace, uids, recorded)
+		if err != nil {
+			log.Warn().Msgf("集群 %q 孤儿资源扫描失败 %s", name, err)
+			continue
+		}
+		orphans = append(orphans, found...)
+	}
+	return orphans, nil
+}
+
+func scanCluster(name string, grace time.Duration, uids map[string]string, recorded sets.String) ([]Orphan, error) {
+	client, err := cluster.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	gvrs, err := listable(client.Discovery)
+	if err != nil {
+		return nil, err
+	}
+	opt := metav1.ListOptions{LabelSelector: v1.ShadowUIDLabel}
+	// 同一对象可能由多个api组提供(如Event), 任一组下被记录就不是孤儿
+	seen := sets.NewString()
+	kept := sets.NewString()
+	var orphans []Orphan
+	for _, gvr := range gvrs {
+		list, err := client.Resource(gvr).List(context.TODO(), opt)
+		if err != nil {
+			log.Warn().Msgf("集群 %q 列出 %s 失败 %s", name, gvr.Resource, err)
+			continue
+		}
+		for _, obj := range list.Items {
+			uid := string(obj.GetUID())
+			if uid == "" || kept.Has(uid) || time.Since(obj.GetCreationTimestamp().Time) < grace {
+				continue
+			}
+			reason, orphan := orphanReason(&obj, name, gvr.Group, uids, recorded)
+			if !orphan {
+				kept.Insert(uid)
+				continue
+			}
+			if seen.Has(uid) {
+				continue
+			}
+			seen.Insert(uid)
+			labels := obj.GetLabels()
+			shadow := labels[v1.ShadowNSLabel] + "/" + labels[v1.ShadowNameLabel]
+			orphans = append(orphans, Orphan{
+				Cluster:   name,
+				GVR:       gvr,
+				Kind:      obj.GetKind(),
+				Namespace: obj.GetNamespace(),
+				Name:      obj.GetName(),
+				UID:       obj.GetUID(),
+				Shadow:    shadow,
+				Reason:    reason,
+			})
+		}
+	}
+	return withoutKept(orphans, kept), nil
+}
+
+// withoutKept 去掉在其它api组下被记录的对象
+func withoutKept(orphans []Orphan, kept sets.String) []Orphan {
+	var list []Orphan
+	for _, o := range orphans {
+		if !kept.Has(string(o.UID)) {
+			list = append(list, o)
+		}
+	}
+	return list
+}
+
+// orphanReason 判断带shadow标签的子资源是否为孤儿, uid标签为空的对象不是shadow写入的, 不做处理
+func orphanReason(obj *unstructured.Unstructured, cluster, group string, uids map[string]string, recorded sets.String) (string, bool) {
+	labels := obj.GetLabels()
+	if labels[v1.ShadowUIDLabel] == "" {
+		return "", false
+	}
+	shadow := labels[v1.ShadowNSLabel] + "/" + labels[v1.ShadowNameLabel]
+	uid, ok := uids[shadow]
+	switch {
+	case !ok:
+		return fmt.Sprintf("shadow %s no longer exists", shadow), true
+	case uid != labels[v1.ShadowUIDLabel]:
+		return fmt.Sprintf("shadow %s was recreated with uid %s", shadow, uid), true
+	case !recorded.Has(childKey(cluster, group, obj.GetKind(), obj.GetNamespace(), obj.GetName())):
+		return fmt.Sprintf("not recorded by shadow %s", shadow), true
+	}
+	return "", false
+}
+
+// skipGroups 不扫描shadow自身与shim所在的api组. 聚合api的list会忽略标签选择器,
+// 返回的shadow没有标签, 否则会被当作孤儿删除
+var skipGroups = sets.NewString(v1.ShadowApiGroup, crd.StoreGVR.Group)
+
+// listable 返回集群中可以list与delete的资源, 部分api组发现失败时使用其余结果
+func listable(dc discovery.DiscoveryInterface) ([]schema.GroupVersionResource, error) {
+	lists, err := discovery.ServerPreferredResources(dc)
+	if err != nil && len(lists) == 0 {
+		return nil, err
+	}
+	var gvrs []schema.GroupVersionResource
+	for _, l := range lists {
+		gv, err := schema.ParseGroupVersion(l.GroupVersion)
+		if err != nil || skipGroups.Has(gv.Group) {
+			continue
+		}
+		for _, r := range l.APIResources {
+			if strings.Contains(r.Name, "/") || !sets.NewString(r.Verbs...).HasAll("list", "delete") {
+				continue
+			}
+			gvrs = append(gvrs, gv.WithResource(r.Name))
+		}
+	}
+	return gvrs, nil
+}
+
+// Delete 删除孤儿资源, 以uid为前置条件, 避免误删同名的新资源
+func Delete(o Orphan) error {
+	client, err := cluster.Get(o.Cluster)
+	if err != nil {
+		return err
+	}
+	opt := metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &o.UID}}
+	if o.Namespace == "" {
+		return client.Resource(o.GVR).Delete(context.TODO(), o.Name, opt)
+	}
+	return client.Resource(o.GVR).Namespace(o.Namespace).Delete(context.TODO(), o.Name, opt)
+}
+
+// Run 每隔 config.OrphanScanInterval 在leader上扫描一次孤儿资源, 开启 config.OrphanDelete 时删除它们
+func Run(stopCh <-chan struct{}) {
+	if config.OrphanScanInterval <= 0 {
+		return
+	}
+	go wait.Until(func() {
+		if !leader.IsLeader() {
+			return
+		}
+		orphans, err := Scan(config.OrphanGracePeriod)
+		if err != nil {
+			log.Error().Msgf("孤儿资源扫描失败 %s", err)
+			return
+		}
+		metrics.Orphans.Set(float64(len(orphans)))
+		for _, o := range orphans {
+			if !config.OrphanDelete {
+				log.Warn().Msgf("发现孤儿资源 %s: %s", o, o.Reason)
+				continue
+			}
+			if err = Delete(o); err != nil {
+				log.Error().Msgf("删除孤儿资源 %s 失败 %s", o, err)
+				continue
+			}
+			log.Info().Msgf("删除孤儿资源 %s: %s", o, o.Reason)
+		}
+	}, config.OrphanScanInterval, stopCh)
+}
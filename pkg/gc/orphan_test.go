@@ -0,0 +1,130 @@
+package gc
+
+import (
+	"testing"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestListableSkipsShadowGroups(t *testing.T) {
+	verbs := metav1.Verbs{"list", "delete", "get"}
+	dc := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: verbs},
+			{Name: "deployments/scale", Kind: "Scale", Namespaced: true, Verbs: verbs},
+		}},
+		{GroupVersion: v1.SchemeGroupVersion.String(), APIResources: []metav1.APIResource{
+			{Name: v1.ShadowResourceName, Kind: v1.ShadowKind, Namespaced: true, Verbs: verbs},
+		}},
+		{GroupVersion: crd.StoreGVR.GroupVersion().String(), APIResources: []metav1.APIResource{
+			{Name: crd.StoreGVR.Resource, Kind: crd.StoreKind, Namespaced: true, Verbs: verbs},
+		}},
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs},
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: metav1.Verbs{"list"}},
+		}},
+	}}}
+
+	gvrs, err := listable(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sets.NewString()
+	for _, gvr := range gvrs {
+		got.Insert(gvr.String())
+	}
+	want := sets.NewString("apps/v1, Resource=deployments", "/v1, Resource=configmaps")
+	if !got.Equal(want) {
+		t.Fatalf("listable() = %v, want %v", got.List(), want.List())
+	}
+}
+
+func TestOrphanReason(t *testing.T) {
+	child := func(labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("default")
+		obj.SetName("cfg")
+		obj.SetUID("child-uid")
+		obj.SetLabels(labels)
+		return obj
+	}
+	shadowLabels := func(uid string) map[string]string {
+		return map[string]string{v1.ShadowNSLabel: "default", v1.ShadowNameLabel: "app", v1.ShadowUIDLabel: uid}
+	}
+	uids := map[string]string{"default/app": "uid-1"}
+	recorded := sets.NewString(childKey("", "", "ConfigMap", "default", "cfg"))
+
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		uids     map[string]string
+		recorded sets.String
+		orphan   bool
+	}{
+		{name: "recorded child", obj: child(shadowLabels("uid-1")), uids: uids, recorded: recorded},
+		{name: "no uid label", obj: child(nil), uids: map[string]string{}, recorded: sets.NewString()},
+		{name: "empty uid label", obj: child(shadowLabels("")), uids: map[string]string{}, recorded: sets.NewString()},
+		{name: "shadow missing", obj: child(shadowLabels("uid-1")), uids: map[string]string{}, recorded: sets.NewString(), orphan: true},
+		{name: "shadow recreated", obj: child(shadowLabels("uid-0")), uids: uids, recorded: recorded, orphan: true},
+		{name: "not recorded", obj: child(shadowLabels("uid-1")), uids: uids, recorded: sets.NewString(), orphan: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, orphan := orphanReason(tt.obj, "", "", tt.uids, tt.recorded)
+			if orphan != tt.orphan {
+				t.Fatalf("orphanReason() = %v (%q), want %v", orphan, reason, tt.orphan)
+			}
+		})
+	}
+}
+
+func TestScanClusterChecksEveryGroup(t *testing.T) {
+	verbs := metav1.Verbs{"list", "delete"}
+	dc := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: verbs},
+		}},
+		{GroupVersion: "events.k8s.io/v1", APIResources: []metav1.APIResource{
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: verbs},
+		}},
+	}}}
+	event := func(apiVersion, name, uid string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind("Event")
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		obj.SetUID(types.UID(uid))
+		obj.SetLabels(map[string]string{v1.ShadowNSLabel: "default", v1.ShadowNameLabel: "app", v1.ShadowUIDLabel: "uid-1"})
+		return obj
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "events"}:                         "EventList",
+		{Group: "events.k8s.io", Version: "v1", Resource: "events"}: "EventList",
+	},
+		event("v1", "recorded", "event-1"), event("events.k8s.io/v1", "recorded", "event-1"),
+		event("v1", "stray", "event-2"), event("events.k8s.io/v1", "stray", "event-2"))
+	cluster.SetLocal(client, nil, dc)
+
+	uids := map[string]string{"default/app": "uid-1"}
+	recorded := sets.NewString(childKey(cluster.Local, "events.k8s.io", "Event", "default", "recorded"))
+	orphans, err := scanCluster(cluster.Local, 0, uids, recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "stray" {
+		t.Fatalf("scanCluster() = %v, want only the stray event", orphans)
+	}
+}
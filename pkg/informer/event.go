@@ -6,29 +6,25 @@ import (
 	"fmt"
 	"github.com/inksnw/shadowresource/pkg/apis/crd"
 	shadowresourcev1 "github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
 	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/events"
+	"github.com/inksnw/shadowresource/pkg/leader"
+	"github.com/inksnw/shadowresource/pkg/metrics"
 	"github.com/inksnw/shadowresource/pkg/utils"
 	"github.com/phuslu/log"
 	"github.com/tidwall/gjson"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 )
 
-var shardInformer dynamicinformer.DynamicSharedInformerFactory
-var informerMap map[schema.GroupVersionResource]bool
-
-func init() {
-	shardInformer = dynamicinformer.NewDynamicSharedInformerFactory(config.DynamicClient, 0)
-	informerMap = make(map[schema.GroupVersionResource]bool)
-}
-
 type Event struct {
+	target Target
 }
 
 func (e Event) OnAdd(obj interface{}) {
-	//fmt.Println("OnAdd")
+	metrics.InformerEvents.WithLabelValues(e.target.String(), "add").Inc()
 }
 
 func getMetaInfoStatus(obj any) (metaInfo crd.Metadata, status string, err error) {
@@ -46,6 +42,10 @@ func getMetaInfoStatus(obj any) (metaInfo crd.Metadata, status string, err error
 }
 
 func (e Event) OnUpdate(oldObj, newObj interface{}) {
+	metrics.InformerEvents.WithLabelValues(e.target.String(), "update").Inc()
+	if !leader.IsLeader() {
+		return
+	}
 	oldInfo, oldStatus, err := getMetaInfoStatus(oldObj)
 	if err != nil {
 		log.Error().Msgf("更新状态失败 %s", err)
@@ -56,9 +56,10 @@ func (e Event) OnUpdate(oldObj, newObj interface{}) {
 		log.Error().Msgf("更新状态失败 %s", err)
 		return
 	}
-	if oldInfo.Name != "" && oldStatus != newStatus {
+	if oldInfo.Name != "" && oldStatus != newStatus && !e.suspended(oldInfo) {
 		log.Info().Msgf(" %s/%s 状态变更 %s --> %s", oldInfo.Namespace, oldInfo.Name, oldStatus, newStatus)
-		err := updateStoreStatus(oldInfo, newStatus)
+		msg := fmt.Sprintf("%s changed from %q to %q", describe(newObj), oldStatus, newStatus)
+		err := updateStoreStatus(oldInfo, newStatus, msg)
 		if err != nil {
 			log.Error().Msgf("更新状态失败 %s", err)
 			return
@@ -66,28 +67,91 @@ func (e Event) OnUpdate(oldObj, newObj interface{}) {
 	}
 }
 
-func updateStoreStatus(metaInfo crd.Metadata, status string) (err error) {
-
-	opt := metav1.PatchOptions{FieldManager: shadowresourcev1.FieldManager}
-	data := []byte(fmt.Sprintf(`{"spec":{"status":"%s"}}`, status))
-	_, err = config.DynamicClient.Resource(crd.StoreGVR).
+// updateStoreStatus 以server-side apply写入shim的status子资源, 状态不变时沿用原来的 LastTransitionTime
+func updateStoreStatus(metaInfo crd.Metadata, status, message string) (err error) {
+	next := crd.CrdStoreStatus{State: status, Message: message, LastTransitionTime: metav1.Now()}
+	if prev := currentStatus(metaInfo); prev != nil && prev.State == status && !prev.LastTransitionTime.IsZero() {
+		next.LastTransitionTime = prev.LastTransitionTime
+	}
+	apply := crd.NewStatusApply(metaInfo.Namespace, metaInfo.Name, next)
+	data, err := json.Marshal(apply)
+	if err != nil {
+		return err
+	}
+	force := true
+	opt := metav1.PatchOptions{FieldManager: shadowresourcev1.FieldManager, Force: &force}
+	utd, err := config.DynamicClient.Resource(crd.StoreGVR).
 		Namespace(metaInfo.Namespace).
-		Patch(context.TODO(), metaInfo.Name, types.MergePatchType, data, opt)
+		Patch(context.TODO(), metaInfo.Name, types.ApplyPatchType, data, opt, "status")
 	if err != nil {
 		return err
 	}
+	uid, _, _ := unstructured.NestedString(utd.Object, "spec", "shadowUid")
+	ref := events.ShadowRef(metaInfo.Namespace, metaInfo.Name, types.UID(uid))
+	if message != "" {
+		events.Normal(ref, events.ReasonStatusChanged, "Status changed to %q: %s", status, message)
+	} else {
+		events.Normal(ref, events.ReasonStatusChanged, "Status changed to %q", status)
+	}
 	log.Info().Msgf(" %s/%s 状态变更  %s 成功", metaInfo.Namespace, metaInfo.Name, status)
 	return nil
 }
 
+// currentStatus 读取shim当前的状态, 读取失败时返回nil
+func currentStatus(metaInfo crd.Metadata) *crd.CrdStoreStatus {
+	obj, err := CacheReader().Get(cluster.Local, crd.StoreGVR, metaInfo.Namespace, metaInfo.Name)
+	if err != nil {
+		return nil
+	}
+	ins := &crd.CrdStore{}
+	if err = ins.FromUnstructured(obj); err != nil {
+		return nil
+	}
+	return ins.Status
+}
+
+// SetStatus 直接设置shadow的状态, 用于提交过程中汇报进度
+func SetStatus(ns, name, status, message string) error {
+	return updateStoreStatus(crd.Metadata{Name: name, Namespace: ns}, status, message)
+}
+
+// describe 形如 Deployment default/nginx, 用于状态说明
+func describe(obj any) string {
+	utd, err := utils.ConvertToUnstructured(obj)
+	if err != nil {
+		return ""
+	}
+	if utd.GetNamespace() == "" {
+		return fmt.Sprintf("%s %s", utd.GetKind(), utd.GetName())
+	}
+	return fmt.Sprintf("%s %s/%s", utd.GetKind(), utd.GetNamespace(), utd.GetName())
+}
+
+// SyncStatus 按第一个子资源的当前状态刷新shadow的状态
+func SyncStatus(ns, name string, first *utils.Item) error {
+	live, err := utils.LiveReader.Get(first.Cluster, first.GVR, first.Obj.GetNamespace(), first.Obj.GetName())
+	if err != nil {
+		return err
+	}
+	_, status, err := getMetaInfoStatus(live)
+	if err != nil {
+		return err
+	}
+	return SetStatus(ns, name, status, fmt.Sprintf("%s is %q", describe(live), status))
+}
+
 func (e Event) OnDelete(obj interface{}) {
+	metrics.InformerEvents.WithLabelValues(e.target.String(), "delete").Inc()
+	if !leader.IsLeader() {
+		return
+	}
 
 	info, _, err := getMetaInfoStatus(obj)
 	if err != nil {
 		log.Error().Msgf("解析主资源失败 %s", err)
 	}
-	if info.Name != "" {
-		err = updateStoreStatus(info, "deleted")
+	if info.Name != "" && !e.suspended(info) {
+		err = updateStoreStatus(info, "deleted", fmt.Sprintf("%s was deleted", describe(obj)))
 		if err != nil {
 			log.Error().Msgf("更新状态失败 %s", err)
 			return
@@ -95,24 +159,50 @@ func (e Event) OnDelete(obj interface{}) {
 	}
 }
 
-func NewEvent() *Event {
-	return &Event{}
+// suspended 暂停中的shadow保持 Suspended 状态, 不随子资源变化. 暂停标记在注册informer时记录
+func (e Event) suspended(metaInfo crd.Metadata) bool {
+	return manager.suspended(e.target, ShadowKey(metaInfo.Namespace, metaInfo.Name))
 }
-func CreateInformer(gvr schema.GroupVersionResource) {
-	if _, ok := informerMap[gvr]; ok {
+
+func NewEvent(target Target) *Event {
+	return &Event{target: target}
+}
+
+// Resync 按第一个子资源的当前状态刷新所有shadow的状态, 在成为leader时补上期间错过的变更
+func Resync() {
+	items, err := CacheReader().List(cluster.Local, crd.StoreGVR, "")
+	if err != nil {
+		log.Error().Msgf("同步状态失败 %s", err)
 		return
 	}
-	event := NewEvent()
-
-	info := shardInformer.ForResource(gvr).Informer()
-	info.AddEventHandler(event)
-	stopCh := make(chan struct{})
-	go info.Run(stopCh)
-	informerMap[gvr] = true
-	log.Info().Msgf("创建informer: %s 成功", gvr.Resource)
+	for _, i := range items {
+		ins := &crd.CrdStore{}
+		if err = ins.FromUnstructured(&i); err != nil || len(ins.Spec.CrInfoList) == 0 || ins.Spec.Suspend {
+			continue
+		}
+		first := ins.Spec.CrInfoList[0]
+		ns := first.Namespace
+		if !first.Namespaced() {
+			ns = ""
+		}
+		live, err := utils.LiveReader.Get(first.Cluster, first.GVR(), ns, first.Name)
+		if err != nil {
+			log.Warn().Msgf("%s/%s 同步状态失败 %s", ins.Namespace, ins.Name, err)
+			continue
+		}
+		_, status, _ := getMetaInfoStatus(live)
+		if status == ins.State() {
+			continue
+		}
+		if err = SetStatus(ins.Namespace, ins.Name, status, fmt.Sprintf("%s is %q", describe(live), status)); err != nil {
+			log.Warn().Msgf("%s/%s 同步状态失败 %s", ins.Namespace, ins.Name, err)
+		}
+	}
+	log.Info().Msgf("同步状态完成, 共 %d 条", len(items))
 }
 
-func ReloadInformer() {
+func ReloadInformer(stopCh <-chan struct{}) {
+	Register(storeKey, false, Target{Cluster: cluster.Local, GVR: crd.StoreGVR})
 	list, err := config.DynamicClient.Resource(crd.StoreGVR).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		log.Error().Msgf("重启载入informer失败 %s", err)
@@ -120,18 +210,18 @@ func ReloadInformer() {
 	}
 	for _, i := range list.Items {
 		ins := &crd.CrdStore{}
-		err = ins.FromUnstructured(&i)
-		if err != nil {
-			log.Error().Msgf("重启载入informer失败 %s", err)
-			return
+		if err = ins.FromUnstructured(&i); err != nil {
+			log.Error().Msgf("%s/%s 载入informer失败 %s", i.GetNamespace(), i.GetName(), err)
+			continue
 		}
-		first := ins.Spec.CrInfoList[0]
-		gvr := schema.GroupVersionResource{
-			Group:    first.Group,
-			Version:  first.Version,
-			Resource: first.Resource,
+		if len(ins.Spec.CrInfoList) == 0 {
+			continue
 		}
-		CreateInformer(gvr)
+		Register(ShadowKey(ins.Namespace, ins.Name), ins.Spec.Suspend, TargetsOf(ins.Spec.CrInfoList)...)
+	}
+	if !manager.WaitForCacheSync(stopCh) {
+		log.Error().Msgf("重启载入informer失败, 缓存未同步")
+		return
 	}
 	log.Info().Msgf("重启载入informer成功, 载入 %d 条", len(list.Items))
 }
@@ -0,0 +1,279 @@
+package informer
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	shadowresourcev1 "github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"github.com/inksnw/shadowresource/pkg/metrics"
+	"github.com/phuslu/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+var manager = NewManager()
+
+// Target informer监听的集群与gvr
+type Target struct {
+	Cluster string
+	GVR     schema.GroupVersionResource
+}
+
+func (t Target) String() string {
+	if t.Cluster == cluster.Local {
+		return t.GVR.Resource
+	}
+	return fmt.Sprintf("%s@%s", t.GVR.Resource, t.Cluster)
+}
+
+type entry struct {
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+	// shadows 使用该informer的shadow及其是否暂停, 为空时informer被停止
+	shadows map[string]bool
+}
+
+// Manager 按集群与gvr管理informer, 以使用它的shadow做引用计数
+type Manager struct {
+	mu        sync.Mutex
+	informers map[Target]*entry
+	stopped   bool
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		informers: make(map[Target]*entry),
+	}
+}
+
+// storeKey shim的informer常驻, 不随shadow释放
+const storeKey = "shims"
+
+func ShadowKey(ns, name string) string {
+	return fmt.Sprintf("%s/%s", ns, name)
+}
+
+// Register 将shadow使用的informer设置为targets, 不再使用的informer会被释放.
+// suspend 为shadow的 spec.suspend, 事件处理据此跳过暂停中的shadow
+func (m *Manager) Register(shadow string, suspend bool, targets ...Target) {
+	want := make(map[Target]bool, len(targets))
+	for _, t := range targets {
+		want[t] = true
+	}
+	// 集群客户端在锁外获取, 首次访问某个集群需要做discovery, 慢的集群不阻塞其它shadow
+	clients := make(map[Target]*cluster.Client, len(want))
+	for t := range want {
+		client, err := cluster.Get(t.Cluster)
+		if err != nil {
+			log.Error().Msgf("创建informer: %s 失败 %s", t, err)
+			continue
+		}
+		clients[t] = client
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return
+	}
+	for t := range m.informers {
+		if !want[t] {
+			m.release(t, shadow)
+		}
+	}
+	for t := range want {
+		e, ok := m.informers[t]
+		if !ok {
+			client, ok := clients[t]
+			if !ok {
+				continue
+			}
+			e = m.start(t, client)
+			m.informers[t] = e
+		}
+		e.shadows[shadow] = suspend
+	}
+	metrics.ActiveInformers.Set(float64(len(m.informers)))
+}
+
+// Release 释放shadow使用的所有informer
+func (m *Manager) Release(shadow string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for t := range m.informers {
+		m.release(t, shadow)
+	}
+	metrics.ActiveInformers.Set(float64(len(m.informers)))
+}
+
+// Shutdown 停止所有informer, 之后的Register不再生效
+func (m *Manager) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for t, e := range m.informers {
+		close(e.stopCh)
+		delete(m.informers, t)
+	}
+	m.stopped = true
+	metrics.ActiveInformers.Set(0)
+	log.Info().Msgf("已停止所有informer")
+}
+
+// WaitForCacheSync 等待当前所有informer完成同步
+func (m *Manager) WaitForCacheSync(stopCh <-chan struct{}) bool {
+	m.mu.Lock()
+	factories := make([]dynamicinformer.DynamicSharedInformerFactory, 0, len(m.informers))
+	for _, e := range m.informers {
+		factories = append(factories, e.factory)
+	}
+	m.mu.Unlock()
+
+	synced := true
+	for _, factory := range factories {
+		for gvr, ok := range factory.WaitForCacheSync(stopCh) {
+			if !ok {
+				log.Warn().Msgf("informer: %s 同步失败", gvr.Resource)
+				synced = false
+			}
+		}
+	}
+	return synced
+}
+
+// Unsynced 返回尚未完成同步的informer
+func (m *Manager) Unsynced() (targets []Target) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for t, e := range m.informers {
+		if !e.informer.HasSynced() {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// suspended 返回注册时记录的shadow是否暂停
+func (m *Manager) suspended(t Target, shadow string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.informers[t]
+	return ok && e.shadows[shadow]
+}
+
+func (m *Manager) synced(t Target) (*entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.informers[t]
+	if !ok || !e.informer.HasSynced() {
+		return nil, false
+	}
+	return e, true
+}
+
+// 每个informer使用独立的factory, 以便单独停止
+func (m *Manager) start(t Target, client *cluster.Client) *entry {
+	var factory dynamicinformer.DynamicSharedInformerFactory
+	if t.GVR == crd.StoreGVR {
+		factory = dynamicinformer.NewDynamicSharedInformerFactory(client.Dynamic, 0)
+	} else {
+		// 子资源只缓存带有shadow标签的对象
+		factory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(client.Dynamic, 0, metav1.NamespaceAll,
+			func(opt *metav1.ListOptions) {
+				opt.LabelSelector = shadowresourcev1.ShadowNameLabel
+			})
+	}
+	info := factory.ForResource(t.GVR).Informer()
+	// shim的informer只用于缓存读取, 不参与状态同步
+	if t.GVR != crd.StoreGVR {
+		info.AddEventHandler(NewEvent(t))
+	}
+	e := &entry{
+		factory:  factory,
+		informer: info,
+		stopCh:   make(chan struct{}),
+		shadows:  make(map[string]bool),
+	}
+	factory.Start(e.stopCh)
+	log.Info().Msgf("创建informer: %s 成功", t)
+	return e
+}
+
+func (m *Manager) release(t Target, shadow string) {
+	e, ok := m.informers[t]
+	if !ok {
+		return
+	}
+	if _, ok = e.shadows[shadow]; !ok {
+		return
+	}
+	delete(e.shadows, shadow)
+	if len(e.shadows) > 0 {
+		return
+	}
+	close(e.stopCh)
+	delete(m.informers, t)
+	log.Info().Msgf("停止informer: %s", t)
+}
+
+// TargetsOf 返回缓存子资源所需的informer, 同一集群与gvr只返回一次
+func TargetsOf(children []crd.CrInfo) []Target {
+	seen := make(map[Target]bool, len(children))
+	var targets []Target
+	for _, c := range children {
+		t := Target{Cluster: c.Cluster, GVR: c.GVR()}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+func Register(shadow string, suspend bool, targets ...Target) {
+	manager.Register(shadow, suspend, targets...)
+}
+
+func Release(shadow string) {
+	manager.Release(shadow)
+}
+
+func Shutdown() {
+	manager.Shutdown()
+}
+
+// CountStates 从shim缓存中按状态统计shadow数量, 缓存未同步时返回空
+func CountStates() map[string]int {
+	e, ok := manager.synced(Target{Cluster: cluster.Local, GVR: crd.StoreGVR})
+	if !ok {
+		return nil
+	}
+	states := make(map[string]int)
+	for _, obj := range e.informer.GetStore().List() {
+		utd, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		ins := &crd.CrdStore{}
+		if err := ins.FromUnstructured(utd); err != nil {
+			continue
+		}
+		states[ins.State()]++
+	}
+	return states
+}
+
+// CheckSynced 用于readyz, 所有informer同步完成前返回错误
+func CheckSynced(_ *http.Request) error {
+	if targets := manager.Unsynced(); len(targets) > 0 {
+		return fmt.Errorf("informers not synced: %v", targets)
+	}
+	return nil
+}
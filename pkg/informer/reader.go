@@ -0,0 +1,65 @@
+package informer
+
+import (
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// cacheReader 优先从已同步的informer缓存读取, 没有对应informer时回退到api server
+type cacheReader struct {
+	m *Manager
+}
+
+func CacheReader() utils.Reader {
+	return cacheReader{m: manager}
+}
+
+func (r cacheReader) Get(cluster string, gvr schema.GroupVersionResource, ns, name string) (*unstructured.Unstructured, error) {
+	e, ok := r.m.synced(Target{Cluster: cluster, GVR: gvr})
+	if !ok {
+		return utils.LiveReader.Get(cluster, gvr, ns, name)
+	}
+	lister := e.factory.ForResource(gvr).Lister()
+	var obj runtime.Object
+	var err error
+	if ns == "" {
+		obj, err = lister.Get(name)
+	} else {
+		obj, err = lister.ByNamespace(ns).Get(name)
+	}
+	if errors.IsNotFound(err) {
+		// 刚创建的shim可能还没有进入缓存, 旧版本创建的子资源没有shadow标签, 不在缓存中
+		return utils.LiveReader.Get(cluster, gvr, ns, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*unstructured.Unstructured).DeepCopy(), nil
+}
+
+func (r cacheReader) List(cluster string, gvr schema.GroupVersionResource, ns string) ([]unstructured.Unstructured, error) {
+	e, ok := r.m.synced(Target{Cluster: cluster, GVR: gvr})
+	if !ok {
+		return utils.LiveReader.List(cluster, gvr, ns)
+	}
+	var objs []runtime.Object
+	var err error
+	lister := e.factory.ForResource(gvr).Lister()
+	if ns == "" {
+		objs, err = lister.List(labels.Everything())
+	} else {
+		objs, err = lister.ByNamespace(ns).List(labels.Everything())
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, *obj.(*unstructured.Unstructured).DeepCopy())
+	}
+	return items, nil
+}
@@ -0,0 +1,77 @@
+package leader
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/phuslu/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const leaseName = "shadowresource"
+
+var leading atomic.Bool
+
+// IsLeader 当前副本是否应执行后台任务, 未开启选举时始终为true
+func IsLeader() bool {
+	return !config.LeaderElect || leading.Load()
+}
+
+// Run 参与选举直到stopCh关闭, 失去leader后重新参与选举.
+// 每次成为leader时调用onStarted, 未开启选举时直接调用一次
+func Run(stopCh <-chan struct{}, onStarted func()) {
+	if !config.LeaderElect {
+		go onStarted()
+		return
+	}
+	hostname, _ := os.Hostname()
+	id, _ := uuid.NewUUID()
+	identity := hostname + "_" + id.String()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: config.LeaderElectNamespace,
+		},
+		Client:     config.K8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go func() {
+		for ctx.Err() == nil {
+			leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+				Lock:            lock,
+				LeaseDuration:   15 * time.Second,
+				RenewDeadline:   10 * time.Second,
+				RetryPeriod:     2 * time.Second,
+				ReleaseOnCancel: true,
+				Callbacks: leaderelection.LeaderCallbacks{
+					OnStartedLeading: func(context.Context) {
+						leading.Store(true)
+						log.Info().Msgf("%s 成为leader, 开始执行后台任务", identity)
+						onStarted()
+					},
+					OnStoppedLeading: func() {
+						leading.Store(false)
+						log.Warn().Msgf("%s 不再是leader, 停止执行后台任务", identity)
+					},
+					OnNewLeader: func(current string) {
+						if current != identity {
+							log.Info().Msgf("当前leader为 %s", current)
+						}
+					},
+				},
+			})
+		}
+	}()
+}
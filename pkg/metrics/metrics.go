@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const namespace = "shadowresource"
+
+const (
+	OperationCreated = "created"
+	OperationUpdated = "updated"
+	OperationDeleted = "deleted"
+)
+
+var (
+	// ShadowOperations 按操作统计shadow的创建/更新/删除次数
+	ShadowOperations = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      namespace,
+		Name:           "shadow_operations_total",
+		Help:           "Number of shadows created, updated and deleted",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"operation"})
+
+	// ChildApplyDuration 单个子资源提交的耗时
+	ChildApplyDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Namespace:      namespace,
+		Name:           "child_apply_duration_seconds",
+		Help:           "Latency of applying a single child, by group, version and resource",
+		Buckets:        metrics.ExponentialBuckets(0.005, 2, 12),
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"group", "version", "resource"})
+
+	// ChildApplyFailures 子资源提交失败次数
+	ChildApplyFailures = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      namespace,
+		Name:           "child_apply_failures_total",
+		Help:           "Number of failed child applies, by group, version and resource",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"group", "version", "resource"})
+
+	// InformerEvents informer收到的事件数
+	InformerEvents = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      namespace,
+		Name:           "informer_events_total",
+		Help:           "Number of events received by the informers, by target and event type",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"target", "event"})
+
+	// ActiveInformers 当前运行中的informer数
+	ActiveInformers = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      namespace,
+		Name:           "active_informers",
+		Help:           "Number of running informers",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// Orphans 最近一次扫描发现的孤儿子资源数
+	Orphans = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      namespace,
+		Name:           "orphans",
+		Help:           "Number of children found without an owning shadow by the last scan",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	shadowsDesc = metrics.NewDesc(namespace+"_shadows",
+		"Number of shadows by status.State",
+		[]string{"state"}, nil, metrics.ALPHA, "")
+)
+
+var registerOnce sync.Once
+
+// Register 注册所有指标, states在每次采集时返回按状态统计的shadow数量
+func Register(states func() map[string]int) {
+	registerOnce.Do(func() {
+		legacyregistry.MustRegister(ShadowOperations, ChildApplyDuration, ChildApplyFailures,
+			InformerEvents, ActiveInformers, Orphans)
+		legacyregistry.CustomMustRegister(&stateCollector{states: states})
+	})
+}
+
+// ObserveApply 记录一次子资源提交的耗时与结果
+func ObserveApply(gvr schema.GroupVersionResource, seconds float64, err error) {
+	ChildApplyDuration.WithLabelValues(gvr.Group, gvr.Version, gvr.Resource).Observe(seconds)
+	if err != nil {
+		ChildApplyFailures.WithLabelValues(gvr.Group, gvr.Version, gvr.Resource).Inc()
+	}
+}
+
+// stateCollector 采集时才统计, 避免在每次状态变更时维护计数
+type stateCollector struct {
+	metrics.BaseStableCollector
+	states func() map[string]int
+}
+
+func (c *stateCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- shadowsDesc
+}
+
+func (c *stateCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	for state, n := range c.states() {
+		ch <- metrics.NewLazyConstMetric(shadowsDesc, metrics.GaugeValue, float64(n), state)
+	}
+}
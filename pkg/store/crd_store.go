@@ -9,16 +9,22 @@ import (
 	"github.com/inksnw/shadowresource/pkg/apis/crd"
 	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
 	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/events"
 	"github.com/inksnw/shadowresource/pkg/informer"
+	"github.com/inksnw/shadowresource/pkg/metrics"
 	"github.com/inksnw/shadowresource/pkg/utils"
 	"github.com/phuslu/log"
 	"github.com/tidwall/gjson"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
@@ -89,7 +95,11 @@ func (f *store) ShortNames() []string {
 
 func (f *store) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
 	requestInfo, _ := request.RequestInfoFrom(ctx)
-	rv, err := utils.ForGet(name, requestInfo.Namespace)
+	reader := utils.LiveReader
+	if options != nil {
+		reader = readerFor(options.ResourceVersion)
+	}
+	rv, err := utils.ForGet(name, requestInfo.Namespace, reader)
 
 	return rv, err
 
@@ -98,55 +108,195 @@ func (f *store) Get(ctx context.Context, name string, options *metav1.GetOptions
 func (f *store) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
 	info, _ := request.RequestInfoFrom(ctx)
 	log.Info().Msgf("查询列表 %s", info.Path)
-	list, err := utils.ForList(info.Namespace)
+	list, err := utils.ForList(info.Namespace, readerFor(options.ResourceVersion))
 	return list, err
 }
 
+// readerFor 默认从informer缓存读取, 开启LiveReadOnEmptyRV时 resourceVersion="" 的请求直接读api server
+func readerFor(resourceVersion string) utils.Reader {
+	if resourceVersion == "" && config.LiveReadOnEmptyRV {
+		return utils.LiveReader
+	}
+	return informer.CacheReader()
+}
+
 func (f *store) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc,
 	options *metav1.CreateOptions) (runtime.Object, error) {
 	ma, _ := obj.(*v1.ShadowResource)
-	if len(ma.Spec.FlowList) == 0 {
-		return obj, errors.New("you must set spec.flowList")
+	if createValidation != nil {
+		if err := createValidation(ctx, obj.DeepCopyObject()); err != nil {
+			return nil, err
+		}
+	}
+	in, err := desiredTasks(ma)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil && len(options.DryRun) > 0 {
+		return obj, nil
 	}
 
-	var in []json.RawMessage
-	for _, i := range ma.Spec.FlowList {
-		bytes, err := json.Marshal(i)
-		if err != nil {
+	shim, err := loadShim(ma.Namespace, ma.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	ma.UID = shadowUID(shim)
+	var previous []crd.SuspendedChild
+	if shim != nil {
+		previous = shim.Spec.Suspended
+	}
+	applyIn := in
+	var suspended []crd.SuspendedChild
+	if ma.Spec.Suspend {
+		if applyIn, suspended, err = utils.PrepareSuspend(in, ma.Spec.TargetCluster, previous); err != nil {
 			return nil, err
 		}
-		in = append(in, bytes)
 	}
 
-	shadowInfo := crd.Metadata{
-		Name:      ma.Name,
-		Namespace: ma.Namespace,
+	progress := func(wave, total int) {
+		if total == 1 {
+			return
+		}
+		err := informer.SetStatus(ma.Namespace, ma.Name, fmt.Sprintf("Applying %d/%d", wave, total),
+			fmt.Sprintf("applying wave %d of %d", wave, total))
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Warn().Msgf("更新提交进度失败 %s", err)
+		}
+	}
+	opts := utils.ApplyOptions{
+		Shadow:   crd.Metadata{Name: ma.Name, Namespace: ma.Namespace},
+		UID:      ma.UID,
+		Adopt:    ma.Spec.Adopt,
+		Cluster:  ma.Spec.TargetCluster,
+		Progress: progress,
+	}
+	if err := utils.ForApply(applyIn, opts); err != nil {
+		return nil, err
+	}
+	ref := events.ShadowRef(ma.Namespace, ma.Name, ma.UID)
+	if ma.Spec.Suspend {
+		err = utils.ForSuspend(ref, suspended)
+	} else if len(previous) > 0 {
+		err = utils.ForResume(ref, in, ma.Spec.TargetCluster, previous)
+	}
+	if err != nil {
+		return nil, err
 	}
-	marshal, _ := json.Marshal(shadowInfo)
 
-	if err := utils.ForApply(in, string(marshal)); err != nil {
+	revision, err := utils.SaveRevision(ma.Name, ma.Namespace, in)
+	if err != nil {
 		return nil, err
 	}
+	ma.Status.Revision = revision
 
-	if err := saveCrdStore(ma); err != nil {
+	if err := saveCrdStore(ma, in, revision, suspended); err != nil {
 		return nil, err
 	}
 
-	first := ma.Spec.FlowList[0]
-	firstJs, err := json.Marshal(first)
+	first, err := utils.ResolveItem(in[0], ma.Spec.TargetCluster)
 	if err != nil {
 		return nil, err
 	}
-	gvr, _, err := utils.GetInfoFromBytes(firstJs)
+	if ma.Spec.Suspend {
+		err = informer.SetStatus(ma.Namespace, ma.Name, crd.StateSuspended, fmt.Sprintf("%d children suspended", len(suspended)))
+	} else {
+		err = informer.SyncStatus(ma.Namespace, ma.Name, first)
+	}
+	if err != nil {
+		log.Warn().Msgf("更新状态失败 %s", err)
+	}
+	// 不再使用的informer(子资源被移除或清理)随之释放
+	children := make([]crd.CrInfo, 0, len(in))
+	for _, js := range in {
+		item, err := utils.ResolveItem(js, ma.Spec.TargetCluster)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, item.CrInfo())
+	}
+	informer.Register(informer.ShadowKey(ma.Namespace, ma.Name), ma.Spec.Suspend, informer.TargetsOf(children)...)
+
+	return obj, nil
+}
+
+// desiredTasks 展开回滚版本与source, 返回补全命名空间并校验通过的flowList
+func desiredTasks(ma *v1.ShadowResource) ([]json.RawMessage, error) {
+	if ma.Spec.RollbackTo != nil {
+		flowList, err := utils.GetRevision(ma.Name, ma.Namespace, *ma.Spec.RollbackTo)
+		if errors.Is(err, utils.ErrRevisionNotFound) {
+			kind := schema.GroupKind{Group: v1.ShadowApiGroup, Kind: v1.ShadowKind}
+			return nil, apierrors.NewInvalid(kind, ma.Name, field.ErrorList{
+				field.NotFound(field.NewPath("spec", "rollbackTo"), *ma.Spec.RollbackTo)})
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("%s/%s 回滚到版本 %d", ma.Namespace, ma.Name, *ma.Spec.RollbackTo)
+		// 版本记录中已包含当时由source展开的子资源
+		ma.Spec.FlowList = flowList
+		ma.Spec.RollbackTo = nil
+		ma.Spec.Source = nil
+	}
+	// source展开的条目不写回 spec.flowList, 再次提交同一个source时不会重复
+	flowList := ma.Spec.FlowList
+	if ma.Spec.Source != nil {
+		items, errs := utils.ExpandSource(ma.Spec.Source, ma.Namespace)
+		if len(errs) > 0 {
+			kind := schema.GroupKind{Group: v1.ShadowApiGroup, Kind: v1.ShadowKind}
+			return nil, apierrors.NewInvalid(kind, ma.Name, errs)
+		}
+		log.Info().Msgf("%s/%s 从source载入 %d 个资源", ma.Namespace, ma.Name, len(items))
+		flowList = append(flowList[:len(flowList):len(flowList)], items...)
+	}
+	if len(flowList) == 0 {
+		return nil, errors.New("you must set spec.flowList or spec.source")
+	}
+
+	var in []json.RawMessage
+	for _, i := range flowList {
+		bytes, err := json.Marshal(i)
+		if err != nil {
+			return nil, err
+		}
+		in = append(in, bytes)
+	}
+	in, err := utils.DefaultNamespace(in, ma.Namespace, ma.Spec.TargetCluster)
 	if err != nil {
 		return nil, err
 	}
-	informer.CreateInformer(gvr)
 
-	return obj, err
+	errs := utils.Validate(in, ma.Namespace, ma.Spec.TargetCluster, ma.Spec.Adopt)
+	// 名称会作为标签值写入每个子资源
+	for _, msg := range validation.IsValidLabelValue(ma.Name) {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), ma.Name, msg))
+	}
+	if len(errs) > 0 {
+		kind := schema.GroupKind{Group: v1.ShadowApiGroup, Kind: v1.ShadowKind}
+		return nil, apierrors.NewInvalid(kind, ma.Name, errs)
+	}
+	return in, nil
+}
+
+// shadowUID 已存在的shadow沿用shim中记录的uid, 否则生成新的uid
+func shadowUID(shim *crd.CrdStore) types.UID {
+	if shim == nil {
+		newUUID, _ := uuid.NewUUID()
+		return types.UID(newUUID.String())
+	}
+	return types.UID(shim.Spec.ShadowUid)
+}
+
+func loadShim(ns, name string) (*crd.CrdStore, error) {
+	utd, err := config.DynamicClient.Resource(crd.StoreGVR).
+		Namespace(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ins := &crd.CrdStore{}
+	return ins, ins.FromUnstructured(utd)
 }
 
-func saveCrdStore(sr *v1.ShadowResource) (err error) {
+func saveCrdStore(sr *v1.ShadowResource, tasks []json.RawMessage, revision int64, suspended []crd.SuspendedChild) (err error) {
 	var exist bool
 	oldStore := &crd.CrdStore{}
 	utdStore, err := config.DynamicClient.Resource(crd.StoreGVR).
@@ -157,34 +307,53 @@ func saveCrdStore(sr *v1.ShadowResource) (err error) {
 			return err
 		}
 	}
+	defer func() {
+		if err != nil {
+			return
+		}
+		if exist {
+			metrics.ShadowOperations.WithLabelValues(metrics.OperationUpdated).Inc()
+		} else {
+			metrics.ShadowOperations.WithLabelValues(metrics.OperationCreated).Inc()
+		}
+	}()
 
 	newStore := crd.CrdStore{}
 	newStore.Kind = crd.StoreKind
 	newStore.APIVersion = crd.StoreApiVersion
 	newStore.Namespace = sr.Namespace
 	newStore.Name = sr.Name
-	newUUID, _ := uuid.NewUUID()
-	newStore.Spec.ShadowUid = newUUID.String()
-
-	for _, i := range sr.Spec.FlowList {
-		b, _ := json.Marshal(i)
-		gvr, utd, err := utils.GetInfoFromBytes(b)
+	newStore.Spec.Revision = revision
+	newStore.Spec.TargetCluster = sr.Spec.TargetCluster
+	newStore.Spec.ManagedFields = sr.ManagedFields
+	newStore.Spec.ShadowUid = string(sr.UID)
+	newStore.Spec.Suspend = sr.Spec.Suspend
+	newStore.Spec.Suspended = suspended
+	newStore.Spec.Source = sr.Spec.Source
+	newStore.Spec.SourceItems = len(tasks) - len(sr.Spec.FlowList)
+
+	for _, js := range tasks {
+		item, err := utils.ResolveItem(js, sr.Spec.TargetCluster)
 		if err != nil {
 			return err
 		}
-		info := crd.CrInfo{
-			Group:     gvr.Group,
-			Version:   gvr.Version,
-			Kind:      utd.GetKind(),
-			Resource:  gvr.Resource,
-			Namespace: utd.GetNamespace(),
-			Name:      utd.GetName(),
-		}
-		newStore.Spec.CrInfoList = append(newStore.Spec.CrInfoList, info)
+		newStore.Spec.CrInfoList = append(newStore.Spec.CrInfoList, item.CrInfo())
 	}
-	if exist && reflect.DeepEqual(oldStore.Spec.CrInfoList, newStore.Spec.CrInfoList) {
-		log.Info().Msgf("crd store已经存在 %s/%s", sr.Namespace, sr.Name)
-		return nil
+	if exist {
+		if err = utils.ForPrune(events.ShadowRef(sr.Namespace, sr.Name, sr.UID), utils.StaleCrInfo(oldStore.Spec.CrInfoList, newStore.Spec.CrInfoList)); err != nil {
+			return err
+		}
+		if oldStore.Spec.Revision == revision &&
+			oldStore.Spec.TargetCluster == newStore.Spec.TargetCluster &&
+			oldStore.Spec.Suspend == newStore.Spec.Suspend &&
+			reflect.DeepEqual(oldStore.Spec.Suspended, newStore.Spec.Suspended) &&
+			reflect.DeepEqual(oldStore.Spec.Source, newStore.Spec.Source) &&
+			oldStore.Spec.SourceItems == newStore.Spec.SourceItems &&
+			reflect.DeepEqual(oldStore.Spec.ManagedFields, newStore.Spec.ManagedFields) &&
+			reflect.DeepEqual(oldStore.Spec.CrInfoList, newStore.Spec.CrInfoList) {
+			log.Info().Msgf("crd store已经存在 %s/%s", sr.Namespace, sr.Name)
+			return nil
+		}
 	}
 
 	js, _ := json.Marshal(newStore)
@@ -201,22 +370,101 @@ func (f *store) Update(ctx context.Context, name string, objInfo rest.UpdatedObj
 	forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
 	info, _ := request.RequestInfoFrom(ctx)
 	log.Info().Msgf("收到了更新请求: %s/%s", info.Namespace, info.Name)
-	oldObj, _ := f.Get(ctx, name, nil)
+	oldObj, err := f.Get(ctx, name, nil)
+	var shim *crd.CrdStore
+	if err == nil {
+		if shim, err = loadShim(info.Namespace, name); err != nil {
+			return nil, false, err
+		}
+		if err = checkComplete(shim, oldObj); err != nil {
+			return nil, false, err
+		}
+	}
 
 	newObj, err := objInfo.UpdatedObject(ctx, oldObj)
+	if err != nil {
+		return nil, false, err
+	}
+	if updateValidation != nil {
+		if err = updateValidation(ctx, newObj.DeepCopyObject(), oldObj.DeepCopyObject()); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if ma, ok := newObj.(*v1.ShadowResource); ok && shim != nil {
+		if err = rebase(shim, oldObj, ma); err != nil {
+			return nil, false, err
+		}
+	}
 
-	create, err := f.Create(ctx, newObj, nil, &metav1.CreateOptions{})
+	create, err := f.Create(ctx, newObj, nil, &metav1.CreateOptions{DryRun: options.DryRun})
 
 	return create, false, err
 }
 
+// checkComplete 读取失败且没有版本记录可以占位的子资源不在详情中, 以此为基础更新会把它们当作已移除而清理
+func checkComplete(shim *crd.CrdStore, obj runtime.Object) error {
+	if _, ok := obj.(*unstructured.Unstructured); !ok {
+		return nil
+	}
+	if missing := len(shim.Spec.CrInfoList) - shim.Spec.SourceItems - len(flowListOf(obj)); missing > 0 {
+		return apierrors.NewServiceUnavailable(fmt.Sprintf(
+			"%d children of %s/%s could not be read, see status.childErrors", missing, shim.Namespace, shim.Name))
+	}
+	return nil
+}
+
+// rebase 基于详情的更新带有服务端补全的默认值, 把修改应用到当前版本记录的期望对象上再提交.
+// 回滚使用记录的版本, 不需要处理; 读取不到当前版本时按原样提交, 记录版本时仍会去掉服务端字段
+func rebase(shim *crd.CrdStore, oldObj runtime.Object, ma *v1.ShadowResource) error {
+	if ma.Spec.RollbackTo != nil || shim.Spec.Revision == 0 {
+		return nil
+	}
+	recorded, err := utils.GetRevision(shim.Name, shim.Namespace, shim.Spec.Revision)
+	if err != nil {
+		log.Warn().Msgf("%s/%s 读取版本 %d 失败 %s", shim.Namespace, shim.Name, shim.Spec.Revision, err)
+		return nil
+	}
+	ma.Spec.FlowList, err = utils.RebaseItems(flowListOf(oldObj), ma.Spec.FlowList, recorded)
+	return err
+}
+
+func flowListOf(obj runtime.Object) []v1.FlowItem {
+	utd, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	items, _, _ := unstructured.NestedSlice(utd.Object, "spec", "flowList")
+	var list []v1.FlowItem
+	for _, i := range items {
+		if m, ok := i.(map[string]interface{}); ok {
+			list = append(list, v1.FlowItem{Object: m})
+		}
+	}
+	return list
+}
+
 func (f *store) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc,
 	options *metav1.DeleteOptions) (runtime.Object, bool, error) {
 	info, _ := request.RequestInfoFrom(ctx)
 	log.Info().Msgf("执行删除: %s", info.Namespace)
+	if deleteValidation != nil {
+		old, err := f.Get(ctx, name, &metav1.GetOptions{})
+		if err != nil {
+			return nil, false, err
+		}
+		if err = deleteValidation(ctx, old); err != nil {
+			return nil, false, err
+		}
+	}
 	obj, err := utils.ForDelete(name, info.Namespace)
+	if err != nil {
+		return obj, false, err
+	}
+	informer.Release(informer.ShadowKey(info.Namespace, name))
+	metrics.ShadowOperations.WithLabelValues(metrics.OperationDeleted).Inc()
 
-	return obj, false, err
+	return obj, false, nil
 }
 
 func (f *store) DeleteCollection(ctx context.Context, deleteValidation rest.ValidateObjectFunc,
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/phuslu/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+var _ rest.NamedCreater = &diffStore{}
+var _ rest.Scoper = &diffStore{}
+var _ rest.StorageMetadata = &diffStore{}
+
+// NewDiffStore shadowresources/diff 子资源, POST一个ShadowResource, 以dry-run返回提交后每个子资源的变化
+func NewDiffStore() rest.Storage {
+	return &diffStore{}
+}
+
+type diffStore struct{}
+
+func (d *diffStore) New() runtime.Object {
+	return &v1.ShadowResource{}
+}
+
+func (d *diffStore) Destroy() {
+}
+
+func (d *diffStore) NamespaceScoped() bool {
+	return true
+}
+
+func (d *diffStore) ProducesMIMETypes(verb string) []string {
+	return nil
+}
+
+func (d *diffStore) ProducesObject(verb string) interface{} {
+	return v1.ShadowResourceDiff{}
+}
+
+func (d *diffStore) Create(ctx context.Context, name string, obj runtime.Object,
+	createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	ma, ok := obj.(*v1.ShadowResource)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a %s, got %T", v1.ShadowKind, obj))
+	}
+	if createValidation != nil {
+		if err := createValidation(ctx, obj.DeepCopyObject()); err != nil {
+			return nil, err
+		}
+	}
+	ns, _ := request.NamespaceFrom(ctx)
+	ma.Name = name
+	ma.Namespace = ns
+	log.Info().Msgf("比较 %s/%s 的子资源", ns, name)
+
+	shim, err := loadShim(ns, name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	spec := ma.Spec
+	if apierrors.IsNotFound(err) {
+		// 不存在的shadow所有子资源都是新建
+		if spec.FlowList == nil && spec.Source == nil && spec.RollbackTo == nil {
+			return nil, apierrors.NewNotFound(v1.SchemeGroupResource, name)
+		}
+		shim = &crd.CrdStore{}
+	} else if spec.FlowList == nil && spec.Source == nil && spec.RollbackTo == nil {
+		// 未给出期望内容时比较当前版本与集群中的对象, 用于发现漂移
+		if shim.Spec.Revision == 0 {
+			// 旧版本创建的shim没有记录版本
+			return nil, apierrors.NewBadRequest(fmt.Sprintf(
+				"%s/%s has no recorded revision, post the desired flowList to diff against", ns, name))
+		}
+		ma.Spec.RollbackTo = &shim.Spec.Revision
+		ma.Spec.TargetCluster = shim.Spec.TargetCluster
+		ma.Spec.Suspend = shim.Spec.Suspend
+	}
+
+	in, err := desiredTasks(ma)
+	if err != nil {
+		return nil, err
+	}
+	if ma.Spec.Suspend {
+		if in, _, err = utils.PrepareSuspend(in, ma.Spec.TargetCluster, shim.Spec.Suspended); err != nil {
+			return nil, err
+		}
+	}
+	opts := utils.ApplyOptions{
+		Shadow:  crd.Metadata{Name: name, Namespace: ns},
+		UID:     types.UID(shim.Spec.ShadowUid),
+		Cluster: ma.Spec.TargetCluster,
+	}
+	diffs, err := utils.ForDiff(in, opts, shim.Spec.CrInfoList)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &v1.ShadowResourceDiff{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+		Items:      make([]v1.ChildDiff, 0, len(diffs)),
+	}
+	for _, d := range diffs {
+		result.Items = append(result.Items, v1.ChildDiff{
+			Action:     d.Action,
+			Cluster:    d.Child.Cluster,
+			APIVersion: schema.GroupVersion{Group: d.Child.Group, Version: d.Child.Version}.String(),
+			Kind:       d.Child.Kind,
+			Namespace:  d.Child.Namespace,
+			Name:       d.Child.Name,
+			Diff:       d.Diff,
+			Error:      d.Error,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/utils"
+	"github.com/phuslu/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+var _ rest.Getter = &exportStore{}
+var _ rest.Scoper = &exportStore{}
+
+// NewExportStore shadowresources/export 子资源, 返回去掉服务端字段与默认值的shadow
+func NewExportStore() rest.Storage {
+	return &exportStore{}
+}
+
+type exportStore struct{}
+
+func (e *exportStore) New() runtime.Object {
+	return &v1.ShadowResource{}
+}
+
+func (e *exportStore) Destroy() {
+}
+
+func (e *exportStore) NamespaceScoped() bool {
+	return true
+}
+
+func (e *exportStore) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	ns, _ := request.NamespaceFrom(ctx)
+	log.Info().Msgf("导出 %s/%s", ns, name)
+	shadow, err := utils.ForExport(name, ns)
+	if apierrors.IsNotFound(err) {
+		return nil, apierrors.NewNotFound(v1.SchemeGroupResource, name)
+	}
+	return shadow, err
+}
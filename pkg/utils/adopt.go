@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// errAdoptChanges 接管会修改资源内容
+var errAdoptChanges = errors.New("adopting would change the resource")
+
+// checkAdopt 确认条目对应的资源已经存在, 并以dry-run确认接管后除metadata与status外内容不变.
+// 与其它field manager的冲突由dry-run以Conflict错误返回
+func checkAdopt(item *Item) error {
+	client, err := cluster.Get(item.Cluster)
+	if err != nil {
+		return err
+	}
+	live, err := item.Resource(client).Get(context.TODO(), item.Obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	applied, err := patchItem(item, true)
+	if err != nil {
+		return err
+	}
+	if changed := changedFields(live, applied); len(changed) > 0 {
+		return fmt.Errorf("%w %s: %s", errAdoptChanges, item.CrInfo(), strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// changedFields 返回两个对象中除metadata与status外取值不同的顶层字段
+func changedFields(live, applied *unstructured.Unstructured) []string {
+	keys := make(map[string]bool)
+	for k := range live.Object {
+		keys[k] = true
+	}
+	for k := range applied.Object {
+		keys[k] = true
+	}
+	var changed []string
+	for k := range keys {
+		if k == "metadata" || k == "status" {
+			continue
+		}
+		if !equality.Semantic.DeepEqual(live.Object[k], applied.Object[k]) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// adoptErrors 将checkAdopt的结果挂到条目路径下
+func adoptErrors(path *field.Path, item *Item, err error) field.ErrorList {
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		return field.ErrorList{field.NotFound(path, fmt.Sprintf("%s must exist to be adopted", item.CrInfo()))}
+	case errors.Is(err, errAdoptChanges):
+		return field.ErrorList{field.Forbidden(path, err.Error())}
+	}
+	return dryRunErrors(path, err)
+}
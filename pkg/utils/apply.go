@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/events"
+	"github.com/inksnw/shadowresource/pkg/metrics"
+	"github.com/phuslu/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+type applyTask struct {
+	idx   int
+	item  *Item
+	adopt bool
+}
+
+type ApplyOptions struct {
+	// Shadow 写入第一个子资源注解的shadow信息
+	Shadow crd.Metadata
+	// UID shadow的uid, 子资源的事件记录在该shadow上
+	UID types.UID
+	// Adopt 子资源必须已经存在, 只接管字段归属并打上标签, 不修改其内容
+	Adopt bool
+	// Cluster 未指定目标集群的子资源提交到该集群
+	Cluster string
+	// Progress 在每个wave开始前被调用, 可以为nil
+	Progress func(wave, total int)
+}
+
+// waveOf 读取子资源的wave注解, 未设置时为0
+func waveOf(utd *unstructured.Unstructured) (int, error) {
+	str, ok := utd.GetAnnotations()[v1.WaveAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	wave, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation %q on %s: %w", v1.WaveAnnotation, str, utd.GetName(), err)
+	}
+	return wave, nil
+}
+
+// ForApply 按wave从小到大提交子资源, 同一wave内的资源并发提交, 并发数由 config.ApplyWorkers 限制
+func ForApply(tasks []json.RawMessage, opts ApplyOptions) (err error) {
+	items, err := prepareItems(tasks, opts)
+	if err != nil {
+		return err
+	}
+	waves := make(map[int][]applyTask)
+	for idx, item := range items {
+		wave, err := waveOf(item.Obj)
+		if err != nil {
+			return err
+		}
+		waves[wave] = append(waves[wave], applyTask{idx: idx, item: item, adopt: opts.Adopt})
+	}
+
+	order := make([]int, 0, len(waves))
+	for wave := range waves {
+		order = append(order, wave)
+	}
+	sort.Ints(order)
+
+	ref := events.ShadowRef(opts.Shadow.Namespace, opts.Shadow.Name, opts.UID)
+	for n, wave := range order {
+		if opts.Progress != nil {
+			opts.Progress(n+1, len(order))
+		}
+		log.Info().Msgf("提交 wave %d [%d/%d], 共 %d 个资源", wave, n+1, len(order), len(waves[wave]))
+		if err = applyWave(waves[wave], len(tasks), ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareItems 解析flowList条目, 并加上提交时写入的shadow注解与标签
+func prepareItems(tasks []json.RawMessage, opts ApplyOptions) ([]*Item, error) {
+	metaAnnotations, err := json.Marshal(opts.Shadow)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*Item, 0, len(tasks))
+	for idx, js := range tasks {
+		item, err := ResolveItem(js, opts.Cluster)
+		if err != nil {
+			return nil, err
+		}
+		if idx == 0 {
+			if err = setAnnotation(item.Obj, string(metaAnnotations), v1.ShadowKind); err != nil {
+				return nil, err
+			}
+		}
+		setShadowLabels(item.Obj, opts)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// setShadowLabels 在子资源上标记所属shadow, 用于标签选择与孤儿资源发现
+func setShadowLabels(utd *unstructured.Unstructured, opts ApplyOptions) {
+	labels := utd.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[v1.ShadowNameLabel] = opts.Shadow.Name
+	labels[v1.ShadowNSLabel] = opts.Shadow.Namespace
+	labels[v1.ShadowUIDLabel] = string(opts.UID)
+	utd.SetLabels(labels)
+}
+
+func applyWave(wave []applyTask, total int, ref *corev1.ObjectReference) error {
+	errs := make([]error, len(wave))
+	parallel(len(wave), config.ApplyWorkers, func(n int) {
+		errs[n] = applyOne(wave[n], total, ref)
+	})
+	return utilerrors.NewAggregate(errs)
+}
+
+func applyOne(task applyTask, total int, ref *corev1.ObjectReference) error {
+	item := task.item
+	msg := fmt.Sprintf("[%d/%d]", task.idx+1, total)
+	log.Info().Msgf("%s 提交资源 %s: %s", msg, item.GVR.Resource, item.Obj.GetName())
+	if item.Cluster != cluster.Local {
+		log.Info().Msgf("%s 目标集群 %s", msg, item.Cluster)
+	}
+
+	start := time.Now()
+	var err error
+	if task.adopt {
+		err = checkAdopt(item)
+	}
+	if err == nil {
+		_, err = patchItem(item, false)
+	}
+	metrics.ObserveApply(item.GVR, time.Since(start).Seconds(), err)
+	if err != nil {
+		events.Warning(ref, events.ReasonApplyFailed, "Failed to apply %s: %s", item.CrInfo(), err)
+		return err
+	}
+	events.Normal(ref, events.ReasonApplied, "Applied %s", item.CrInfo())
+	return nil
+}
+
+// patchItem 以server-side apply提交子资源, dryRun时只在服务端校验不落库.
+// 不强制覆盖其它field manager的字段, 冲突会作为错误返回
+func patchItem(item *Item, dryRun bool) (*unstructured.Unstructured, error) {
+	client, err := cluster.Get(item.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	opt := metav1.PatchOptions{FieldManager: v1.FieldManager}
+	if dryRun {
+		opt.DryRun = []string{metav1.DryRunAll}
+	}
+	marshalJSON, err := item.Obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return item.Resource(client).
+		Patch(context.TODO(), item.Obj.GetName(), types.ApplyPatchType, marshalJSON, opt)
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CloneOptions 复制shadow的目标命名空间与名称前后缀, 前后缀同时加在shadow与每个子资源的名称上
+type CloneOptions struct {
+	Namespace string
+	Prefix    string
+	Suffix    string
+	// Namespaced 判断子资源是否属于命名空间, 为空时使用 Mapper
+	Namespaced func(gvk schema.GroupVersionKind) (bool, error)
+}
+
+func (o CloneOptions) namespaced(gvk schema.GroupVersionKind) (bool, error) {
+	if o.Namespaced != nil {
+		return o.Namespaced(gvk)
+	}
+	mapping, err := Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// nameRef 引用其它对象名称的字段, path中的 "*" 表示数组中的每一项
+type nameRef struct {
+	kind string
+	path []string
+}
+
+func refs(kind string, paths ...string) []nameRef {
+	var list []nameRef
+	for _, p := range paths {
+		list = append(list, nameRef{kind: kind, path: strings.Split(p, ".")})
+	}
+	return list
+}
+
+// podSpecRefs pod模板中的引用, 路径相对于pod的spec
+var podSpecRefs = concat(
+	refs("ConfigMap",
+		"volumes.*.configMap.name",
+		"volumes.*.projected.sources.*.configMap.name",
+		"containers.*.envFrom.*.configMapRef.name",
+		"containers.*.env.*.valueFrom.configMapKeyRef.name",
+		"initContainers.*.envFrom.*.configMapRef.name",
+		"initContainers.*.env.*.valueFrom.configMapKeyRef.name"),
+	refs("Secret",
+		"volumes.*.secret.secretName",
+		"volumes.*.projected.sources.*.secret.name",
+		"containers.*.envFrom.*.secretRef.name",
+		"containers.*.env.*.valueFrom.secretKeyRef.name",
+		"initContainers.*.envFrom.*.secretRef.name",
+		"initContainers.*.env.*.valueFrom.secretKeyRef.name",
+		"imagePullSecrets.*.name"),
+	refs("PersistentVolumeClaim", "volumes.*.persistentVolumeClaim.claimName"),
+	refs("ServiceAccount", "serviceAccountName"),
+)
+
+// podSpecPaths 各工作负载中pod spec所在的位置
+var podSpecPaths = map[string]string{
+	"Pod":         "spec",
+	"Deployment":  "spec.template.spec",
+	"StatefulSet": "spec.template.spec",
+	"DaemonSet":   "spec.template.spec",
+	"ReplicaSet":  "spec.template.spec",
+	"Job":         "spec.template.spec",
+	"CronJob":     "spec.jobTemplate.spec.template.spec",
+}
+
+// objectRefs 其它对象中的引用, 字段旁有kind时必须与被引用对象一致
+var objectRefs = concat(
+	refs("Service",
+		"spec.serviceName",
+		"spec.defaultBackend.service.name",
+		"spec.rules.*.http.paths.*.backend.service.name"),
+	refs("Secret", "spec.tls.*.secretName"),
+	refs("Role", "roleRef.name"),
+	refs("ClusterRole", "roleRef.name"),
+	refs("ServiceAccount", "subjects.*.name"),
+	refs("Deployment", "spec.scaleTargetRef.name"),
+	refs("StatefulSet", "spec.scaleTargetRef.name"),
+)
+
+func concat(lists ...[]nameRef) []nameRef {
+	var all []nameRef
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// CloneShadow 将 ForExport 的结果改写为目标命名空间中的新shadow. 源命名空间中的子资源移到目标命名空间,
+// 子资源改名后, 其它子资源中引用它的字段(挂载的ConfigMap/Secret, Ingress后端, RoleBinding等)一并改写.
+// 其它命名空间中的子资源与集群级子资源只改名, 不移动, 没有前后缀时会与源shadow争用同一对象, 因此拒绝复制
+func CloneShadow(shadow *v1.ShadowResource, sourceNS string, opts CloneOptions) (*v1.ShadowResource, error) {
+	clone := shadow.DeepCopy()
+	clone.Name = opts.Prefix + shadow.Name + opts.Suffix
+	clone.Namespace = opts.Namespace
+
+	renamed := make(map[string]string)
+	// moved 随shadow移到目标命名空间的ServiceAccount, 按原名称记录
+	moved := make(map[string]bool)
+	for _, item := range clone.Spec.FlowList {
+		obj := &unstructured.Unstructured{Object: item.Object}
+		if obj.GetNamespace() == sourceNS {
+			obj.SetNamespace("")
+		}
+		if obj.GetKind() == "ServiceAccount" && obj.GetNamespace() == "" {
+			moved[obj.GetName()] = true
+		}
+		if opts.Prefix == "" && opts.Suffix == "" {
+			if err := movable(obj, opts); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		name := opts.Prefix + obj.GetName() + opts.Suffix
+		renamed[obj.GetKind()+"/"+obj.GetName()] = name
+		obj.SetName(name)
+	}
+
+	for _, item := range clone.Spec.FlowList {
+		// RoleBinding 中指向源命名空间且被复制的ServiceAccount, 其它主体保持不变
+		subjects, _, _ := unstructured.NestedSlice(item.Object, "subjects")
+		for _, s := range subjects {
+			m, ok := s.(map[string]interface{})
+			if ok && m["kind"] == "ServiceAccount" && m["namespace"] == sourceNS {
+				if name, _ := m["name"].(string); moved[name] {
+					m["namespace"] = opts.Namespace
+				}
+			}
+		}
+		if subjects != nil {
+			_ = unstructured.SetNestedSlice(item.Object, subjects, "subjects")
+		}
+		kind, _, _ := unstructured.NestedString(item.Object, "kind")
+		if prefix, ok := podSpecPaths[kind]; ok {
+			podSpec := nestedPath(item.Object, strings.Split(prefix, "."))
+			for _, r := range podSpecRefs {
+				rewriteRef(podSpec, r.path, r.kind, renamed)
+			}
+		}
+		for _, r := range objectRefs {
+			rewriteRef(item.Object, r.path, r.kind, renamed)
+		}
+	}
+	return clone, nil
+}
+
+// movable 检查不改名的子资源会被移到目标命名空间, 而不是与源shadow共用
+func movable(obj *unstructured.Unstructured, opts CloneOptions) error {
+	if ns := obj.GetNamespace(); ns != "" {
+		return fmt.Errorf("%s %s/%s stays in namespace %s, a prefix or suffix is required", obj.GetKind(), ns, obj.GetName(), ns)
+	}
+	namespaced, err := opts.namespaced(obj.GroupVersionKind())
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	if !namespaced {
+		return fmt.Errorf("%s %s is cluster scoped, a prefix or suffix is required", obj.GetKind(), obj.GetName())
+	}
+	return nil
+}
+
+func nestedPath(obj map[string]interface{}, path []string) interface{} {
+	var cur interface{} = obj
+	for _, p := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[p]
+	}
+	return cur
+}
+
+// rewriteRef 沿path找到引用字段, 被引用的对象在复制时改了名则改写为新名称
+func rewriteRef(obj interface{}, path []string, kind string, renamed map[string]string) {
+	if len(path) == 0 {
+		return
+	}
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			return
+		}
+		if len(path) > 1 {
+			rewriteRef(o[path[0]], path[1:], kind, renamed)
+			return
+		}
+		name, ok := o[path[0]].(string)
+		if !ok {
+			return
+		}
+		// roleRef, subjects, scaleTargetRef 自带kind
+		if k, ok := o["kind"].(string); ok && k != kind {
+			return
+		}
+		if n, ok := renamed[kind+"/"+name]; ok {
+			o[path[0]] = n
+		}
+	case []interface{}:
+		if path[0] != "*" {
+			return
+		}
+		for _, e := range o {
+			rewriteRef(e, path[1:], kind, renamed)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func flowItem(obj map[string]interface{}) v1.FlowItem {
+	return v1.FlowItem{Object: obj}
+}
+
+func objectMeta(name, ns string) map[string]interface{} {
+	m := map[string]interface{}{"name": name}
+	if ns != "" {
+		m["namespace"] = ns
+	}
+	return m
+}
+
+var clusterKinds = map[string]bool{"ClusterRole": true, "Namespace": true}
+
+func namespacedKind(gvk schema.GroupVersionKind) (bool, error) {
+	return !clusterKinds[gvk.Kind], nil
+}
+
+func testShadow() *v1.ShadowResource {
+	shadow := &v1.ShadowResource{}
+	shadow.Name = "web"
+	shadow.Namespace = "dev"
+	shadow.Spec.FlowList = []v1.FlowItem{
+		flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": objectMeta("cfg", "")}),
+		flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": objectMeta("tls", "")}),
+		flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "ServiceAccount", "metadata": objectMeta("runner", "")}),
+		flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "Service", "metadata": objectMeta("web", "")}),
+		flowItem(map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": objectMeta("web", ""),
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"serviceAccountName": "runner",
+				"volumes": []interface{}{
+					map[string]interface{}{"name": "cfg", "configMap": map[string]interface{}{"name": "cfg"}},
+					map[string]interface{}{"name": "shared", "configMap": map[string]interface{}{"name": "shared"}},
+				},
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "envFrom": []interface{}{
+						map[string]interface{}{"secretRef": map[string]interface{}{"name": "tls"}},
+					}},
+				},
+			}}}}),
+		flowItem(map[string]interface{}{"apiVersion": "networking.k8s.io/v1", "kind": "Ingress", "metadata": objectMeta("web", ""),
+			"spec": map[string]interface{}{
+				"tls": []interface{}{map[string]interface{}{"secretName": "tls"}},
+				"rules": []interface{}{map[string]interface{}{"http": map[string]interface{}{"paths": []interface{}{
+					map[string]interface{}{"backend": map[string]interface{}{"service": map[string]interface{}{"name": "web"}}},
+				}}}},
+			}}),
+		flowItem(map[string]interface{}{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": objectMeta("web", ""),
+			"roleRef": map[string]interface{}{"kind": "ClusterRole", "name": "view"},
+			"subjects": []interface{}{
+				map[string]interface{}{"kind": "ServiceAccount", "name": "runner", "namespace": "dev"},
+				map[string]interface{}{"kind": "ServiceAccount", "name": "deployer", "namespace": "dev"},
+			}}),
+	}
+	return shadow
+}
+
+func nestedField(t *testing.T, shadow *v1.ShadowResource, index int, path ...string) interface{} {
+	t.Helper()
+	v, ok, err := unstructured.NestedFieldNoCopy(shadow.Spec.FlowList[index].Object, path...)
+	if err != nil || !ok {
+		t.Fatalf("item %d has no %v: %v", index, path, err)
+	}
+	return v
+}
+
+func TestCloneShadowRewritesReferences(t *testing.T) {
+	source := testShadow()
+	clone, err := CloneShadow(source, "dev", CloneOptions{Namespace: "test", Prefix: "copy-", Namespaced: namespacedKind})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.Name != "copy-web" || clone.Namespace != "test" {
+		t.Fatalf("clone is %s/%s, want test/copy-web", clone.Namespace, clone.Name)
+	}
+	for i, item := range clone.Spec.FlowList {
+		obj := unstructured.Unstructured{Object: item.Object}
+		if obj.GetNamespace() != "" || obj.GetName()[:5] != "copy-" {
+			t.Errorf("item %d is %s/%s, want it renamed without a namespace", i, obj.GetNamespace(), obj.GetName())
+		}
+	}
+
+	podSpec := []string{"spec", "template", "spec"}
+	if got := nestedField(t, clone, 4, append(podSpec, "serviceAccountName")...); got != "copy-runner" {
+		t.Errorf("serviceAccountName = %v, want copy-runner", got)
+	}
+	volumes := nestedField(t, clone, 4, append(podSpec, "volumes")...).([]interface{})
+	if got := volumes[0].(map[string]interface{})["configMap"]; !reflect.DeepEqual(got, map[string]interface{}{"name": "copy-cfg"}) {
+		t.Errorf("volume cfg = %v, want copy-cfg", got)
+	}
+	// 不属于shadow的对象保持原名
+	if got := volumes[1].(map[string]interface{})["configMap"]; !reflect.DeepEqual(got, map[string]interface{}{"name": "shared"}) {
+		t.Errorf("volume shared = %v, want it unchanged", got)
+	}
+	containers := nestedField(t, clone, 4, append(podSpec, "containers")...).([]interface{})
+	envFrom := containers[0].(map[string]interface{})["envFrom"].([]interface{})
+	if got := envFrom[0].(map[string]interface{})["secretRef"]; !reflect.DeepEqual(got, map[string]interface{}{"name": "copy-tls"}) {
+		t.Errorf("secretRef = %v, want copy-tls", got)
+	}
+
+	tls := nestedField(t, clone, 5, "spec", "tls").([]interface{})
+	if got := tls[0].(map[string]interface{})["secretName"]; got != "copy-tls" {
+		t.Errorf("ingress tls secretName = %v, want copy-tls", got)
+	}
+	rules := nestedField(t, clone, 5, "spec", "rules").([]interface{})
+	paths, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "http", "paths")
+	if got, _, _ := unstructured.NestedString(paths[0].(map[string]interface{}), "backend", "service", "name"); got != "copy-web" {
+		t.Errorf("ingress backend = %v, want copy-web", got)
+	}
+
+	// roleRef 指向shadow之外的ClusterRole, 不改写
+	if got := nestedField(t, clone, 6, "roleRef", "name"); got != "view" {
+		t.Errorf("roleRef = %v, want view", got)
+	}
+	subjects := nestedField(t, clone, 6, "subjects").([]interface{})
+	want := map[string]interface{}{"kind": "ServiceAccount", "name": "copy-runner", "namespace": "test"}
+	if got := subjects[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("subject = %v, want %v", got, want)
+	}
+	// deployer 不在shadow中, 仍指向源命名空间
+	want = map[string]interface{}{"kind": "ServiceAccount", "name": "deployer", "namespace": "dev"}
+	if got := subjects[1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("subject = %v, want %v", got, want)
+	}
+
+	if name, _, _ := unstructured.NestedString(source.Spec.FlowList[4].Object, "spec", "template", "spec", "serviceAccountName"); name != "runner" {
+		t.Errorf("source was modified: serviceAccountName = %s", name)
+	}
+}
+
+func TestCloneShadowShared(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    v1.FlowItem
+		opts    CloneOptions
+		wantErr bool
+	}{
+		{name: "namespaced", item: flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": objectMeta("cfg", "")}),
+			opts: CloneOptions{Namespace: "test"}},
+		{name: "source namespace", item: flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": objectMeta("cfg", "dev")}),
+			opts: CloneOptions{Namespace: "test"}},
+		{name: "cluster scoped", item: flowItem(map[string]interface{}{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": objectMeta("web", "")}),
+			opts: CloneOptions{Namespace: "test"}, wantErr: true},
+		{name: "cluster scoped with suffix", item: flowItem(map[string]interface{}{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": objectMeta("web", "")}),
+			opts: CloneOptions{Namespace: "test", Suffix: "-copy"}},
+		{name: "other namespace", item: flowItem(map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": objectMeta("cfg", "shared")}),
+			opts: CloneOptions{Namespace: "test"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shadow := &v1.ShadowResource{}
+			shadow.Name = "web"
+			shadow.Spec.FlowList = []v1.FlowItem{tt.item}
+			tt.opts.Namespaced = namespacedKind
+			_, err := CloneShadow(shadow, "dev", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CloneShadow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/json"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DiffCreate    = "Create"
+	DiffUpdate    = "Update"
+	DiffUnchanged = "Unchanged"
+	DiffPrune     = "Prune"
+	// DiffFailed 读取或dry-run失败, 原因记录在 Error 中
+	DiffFailed = "Failed"
+)
+
+// ChildDiff 单个子资源提交前后的差异, Diff 为live与desired的yaml统一格式diff
+type ChildDiff struct {
+	Child  crd.CrInfo
+	Action string
+	Diff   string
+	Error  string
+}
+
+func failed(d ChildDiff, err error) ChildDiff {
+	d.Action = DiffFailed
+	d.Diff = ""
+	d.Error = err.Error()
+	return d
+}
+
+// ForDiff 以dry-run提交每个子资源并与当前对象比较, 不会修改集群.
+// recorded 为shadow当前记录的子资源, 其中不在tasks里的会在提交时被清理, 记为 DiffPrune
+func ForDiff(tasks []json.RawMessage, opts ApplyOptions, recorded []crd.CrInfo) ([]ChildDiff, error) {
+	items, err := prepareItems(tasks, opts)
+	if err != nil {
+		return nil, err
+	}
+	// 与校验一致, flowList自身创建的命名空间中的资源无法dry-run
+	namespaces := make(flowNamespaces)
+	created := make([]bool, len(items))
+	for idx, item := range items {
+		namespaces.observe(item)
+		created[idx] = namespaces.creates(item)
+	}
+	diffs := make([]ChildDiff, len(items))
+	parallel(len(items), config.ApplyWorkers, func(idx int) {
+		diffs[idx] = diffItem(items[idx], created[idx])
+	})
+
+	var desired []crd.CrInfo
+	for _, item := range items {
+		desired = append(desired, item.CrInfo())
+	}
+	for _, i := range StaleCrInfo(recorded, desired) {
+		ns := i.Namespace
+		if !i.Namespaced() {
+			ns = ""
+		}
+		d := ChildDiff{Child: i, Action: DiffPrune}
+		live, err := LiveReader.Get(i.Cluster, i.GVR(), ns, i.Name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			diffs = append(diffs, failed(d, err))
+			continue
+		}
+		if d.Diff, err = unifiedDiff(live, nil); err != nil {
+			d = failed(d, err)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// diffItem 单个子资源失败时记录在结果中, 不影响其它子资源.
+// inCreatedNamespace 为true且对象不存在时不做dry-run, 直接与期望对象比较
+func diffItem(item *Item, inCreatedNamespace bool) ChildDiff {
+	d := ChildDiff{Child: item.CrInfo()}
+	ns := item.Obj.GetNamespace()
+	if !item.Namespaced {
+		ns = ""
+	}
+	live, err := LiveReader.Get(item.Cluster, item.GVR, ns, item.Obj.GetName())
+	if err != nil && !errors.IsNotFound(err) {
+		return failed(d, err)
+	}
+	if errors.IsNotFound(err) {
+		live = nil
+	}
+	applied := item.Obj
+	if live != nil || !inCreatedNamespace {
+		if applied, err = patchItem(item, true); err != nil {
+			return failed(d, err)
+		}
+	}
+	if d.Diff, err = unifiedDiff(live, applied); err != nil {
+		return failed(d, err)
+	}
+	switch {
+	case live == nil:
+		d.Action = DiffCreate
+	case d.Diff == "":
+		d.Action = DiffUnchanged
+	default:
+		d.Action = DiffUpdate
+	}
+	return d
+}
+
+// unifiedDiff 比较去掉服务端字段后的yaml, 对象为nil时视为不存在
+func unifiedDiff(live, desired *unstructured.Unstructured) (string, error) {
+	a, err := diffText(live)
+	if err != nil {
+		return "", err
+	}
+	b, err := diffText(desired)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: "live",
+		ToFile:   "desired",
+		Context:  3,
+	})
+}
+
+func diffText(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	obj = obj.DeepCopy()
+	StripServerFields(obj.Object)
+	data, err := yaml.Marshal(obj.Object)
+	return string(data), err
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDiffItemReportsPerChild(t *testing.T) {
+	defer func(r Reader) { LiveReader = r }(LiveReader)
+	item := func() *Item {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("team")
+		obj.SetName("cfg")
+		return &Item{GVR: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, Namespaced: true, Obj: obj}
+	}
+
+	// 命名空间由flowList创建, 不做dry-run直接与期望对象比较
+	LiveReader = failingReader{err: apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "cfg")}
+	d := diffItem(item(), true)
+	if d.Action != DiffCreate || d.Error != "" || d.Diff == "" {
+		t.Fatalf("diffItem() in created namespace = %+v, want Create with a diff", d)
+	}
+
+	LiveReader = failingReader{err: errors.New("connection refused")}
+	d = diffItem(item(), false)
+	if d.Action != DiffFailed || d.Error != "connection refused" {
+		t.Fatalf("diffItem() with reader error = %+v, want Failed", d)
+	}
+}
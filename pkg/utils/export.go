@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// serverMetadata 由服务端生成的metadata字段
+var serverMetadata = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "managedFields", "selfLink", "ownerReferences",
+}
+
+// StripServerFields 去掉对象中由服务端或shadow写入的字段, 结果可以直接重新提交
+func StripServerFields(obj map[string]interface{}) {
+	for _, f := range serverMetadata {
+		unstructured.RemoveNestedField(obj, "metadata", f)
+	}
+	delete(obj, "status")
+	for _, l := range []string{v1.ShadowNameLabel, v1.ShadowNSLabel, v1.ShadowUIDLabel} {
+		unstructured.RemoveNestedField(obj, "metadata", "labels", l)
+	}
+	unstructured.RemoveNestedField(obj, "metadata", "annotations", v1.ShadowKind)
+	unstructured.RemoveNestedField(obj, "metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	for _, f := range []string{"labels", "annotations"} {
+		if m, ok, _ := unstructured.NestedMap(obj, "metadata", f); ok && len(m) == 0 {
+			unstructured.RemoveNestedField(obj, "metadata", f)
+		}
+	}
+}
+
+// ForExport 返回可以提交到其它命名空间或集群的shadow. flowList取自当前版本的记录, 因此不含服务端补全的默认值,
+// 没有版本记录的旧shadow退回使用集群中的对象. 与shadow同命名空间的子资源去掉命名空间, 提交时会补全为新的命名空间
+func ForExport(name, ns string) (*v1.ShadowResource, error) {
+	obj, err := LiveReader.Get(cluster.Local, crd.StoreGVR, ns, name)
+	if err != nil {
+		return nil, err
+	}
+	ins := &crd.CrdStore{}
+	if err = ins.FromUnstructured(obj); err != nil {
+		return nil, err
+	}
+
+	var items []v1.FlowItem
+	if ins.Spec.Revision > 0 {
+		if items, err = GetRevision(name, ns, ins.Spec.Revision); err != nil {
+			return nil, err
+		}
+	} else {
+		children, errs := fetchChildren(ins.Spec.CrInfoList, LiveReader)
+		if err = utilerrors.NewAggregate(errs); err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			items = append(items, v1.FlowItem{Object: child.Object})
+		}
+	}
+	for _, item := range items {
+		StripServerFields(item.Object)
+		if child, _, _ := unstructured.NestedString(item.Object, "metadata", "namespace"); child == ns {
+			unstructured.RemoveNestedField(item.Object, "metadata", "namespace")
+		}
+	}
+
+	shadow := &v1.ShadowResource{}
+	shadow.APIVersion = v1.ShadowAPIVersion
+	shadow.Kind = v1.ShadowKind
+	shadow.Name = name
+	shadow.Spec.FlowList = items
+	shadow.Spec.TargetCluster = ins.Spec.TargetCluster
+	shadow.Spec.Suspend = ins.Spec.Suspend
+	return shadow, nil
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"github.com/inksnw/shadowresource/pkg/apis/crd"
 	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
 	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/inksnw/shadowresource/pkg/events"
 	"github.com/phuslu/log"
-	"github.com/tidwall/gjson"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -22,6 +24,7 @@ import (
 	"k8s.io/client-go/restmapper"
 
 	"os"
+	"sync"
 )
 
 var (
@@ -35,23 +38,31 @@ func InitMapper() {
 		os.Exit(1)
 	}
 	Mapper = restmapper.NewDiscoveryRESTMapper(gr)
+	cluster.SetLocal(config.DynamicClient, Mapper, config.K8sClient.Discovery())
 }
-func ForList(ns string) (rv runtime.Object, err error) {
+func ForList(ns string, reader Reader) (rv runtime.Object, err error) {
 
-	obj, err := config.DynamicClient.Resource(crd.StoreGVR).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+	items, err := reader.List(cluster.Local, crd.StoreGVR, ns)
 	if err != nil {
 		return nil, err
 	}
 	result := &v1.ShadowResourceList{}
 	result.APIVersion = v1.ShadowAPIVersion
 	result.Kind = v1.ShadowKind
-	for _, i := range obj.Items {
-		js, _ := i.MarshalJSON()
+	for _, i := range items {
+		ins := &crd.CrdStore{}
+		if err = ins.FromUnstructured(&i); err != nil {
+			return nil, err
+		}
 		var item v1.ShadowResource
 		item.Name = i.GetName()
 		item.Namespace = i.GetNamespace()
 		item.CreationTimestamp = i.GetCreationTimestamp()
-		item.Status.State = gjson.GetBytes(js, crd.StoreStatusKey).String()
+		item.Status.State = ins.State()
+		if ins.Status != nil {
+			item.Status.Message = ins.Status.Message
+			item.Status.LastTransitionTime = ins.Status.LastTransitionTime
+		}
 		result.Items = append(result.Items, item)
 	}
 	return result, err
@@ -70,20 +81,15 @@ func ForDelete(name, ns string) (runtime.Object, error) {
 		return nil, err
 	}
 
+	ref := events.ShadowRef(ns, name, types.UID(ins.Spec.ShadowUid))
 	for idx, i := range ins.Spec.CrInfoList {
-		subGvr := schema.GroupVersionResource{
-			Group:    i.Group,
-			Version:  i.Version,
-			Resource: i.Resource,
-		}
 		msg := fmt.Sprintf("[%d/%d]", idx+1, len(ins.Spec.CrInfoList))
-		log.Info().Msgf("%s 删除资源 %s: %s", msg, subGvr.Resource, i.Name)
-		err = config.DynamicClient.Resource(subGvr).
-			Namespace(i.Namespace).
-			Delete(context.TODO(), i.Name, metav1.DeleteOptions{})
-		if err != nil {
+		log.Info().Msgf("%s 删除资源 %s: %s", msg, i.Resource, i.Name)
+		if err = deleteChild(i); err != nil {
+			events.Warning(ref, events.ReasonDeleteFailed, "Failed to delete %s: %s", i, err)
 			return nil, err
 		}
+		events.Normal(ref, events.ReasonDeleted, "Deleted %s", i)
 	}
 
 	err = config.DynamicClient.Resource(crd.StoreGVR).
@@ -91,6 +97,9 @@ func ForDelete(name, ns string) (runtime.Object, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = ForDeleteRevisions(name, ns); err != nil {
+		return nil, err
+	}
 
 	shadow := v1.ShadowResource{}
 	shadow.APIVersion = v1.ShadowAPIVersion
@@ -101,15 +110,63 @@ func ForDelete(name, ns string) (runtime.Object, error) {
 	return &shadow, nil
 }
 
-func ForGet(name, ns string) (runtime.Object, error) {
+// ForPrune 删除不再出现在flowList中的子资源, 事件记录在ref上
+func ForPrune(ref *corev1.ObjectReference, stale []crd.CrInfo) error {
+	for idx, i := range stale {
+		msg := fmt.Sprintf("[%d/%d]", idx+1, len(stale))
+		log.Info().Msgf("%s 清理资源 %s: %s", msg, i.Resource, i.Name)
+		if err := deleteChild(i); err != nil && !errors.IsNotFound(err) {
+			events.Warning(ref, events.ReasonDeleteFailed, "Failed to prune %s: %s", i, err)
+			return err
+		}
+		events.Normal(ref, events.ReasonPruned, "Pruned %s", i)
+	}
+	return nil
+}
+
+// StaleCrInfo 返回旧记录中存在而新记录中已经移除的子资源
+func StaleCrInfo(old, new []crd.CrInfo) (stale []crd.CrInfo) {
+	keep := make(map[crd.CrInfo]bool, len(new))
+	for _, i := range new {
+		keep[childKey(i)] = true
+	}
+	for _, i := range old {
+		if !keep[childKey(i)] {
+			stale = append(stale, i)
+		}
+	}
+	return stale
+}
+
+// childKey 只按 cluster/group/kind/namespace/name 比较子资源, 避免版本变化时误删刚提交的资源
+func childKey(i crd.CrInfo) crd.CrInfo {
+	return crd.CrInfo{Cluster: i.Cluster, Group: i.Group, Kind: i.Kind, Namespace: i.Namespace, Name: i.Name}
+}
+
+func deleteChild(i crd.CrInfo) error {
+	client, err := cluster.Get(i.Cluster)
+	if err != nil {
+		return err
+	}
+	if !i.Namespaced() {
+		return client.Resource(i.GVR()).Delete(context.TODO(), i.Name, metav1.DeleteOptions{})
+	}
+	return client.Resource(i.GVR()).
+		Namespace(i.Namespace).
+		Delete(context.TODO(), i.Name, metav1.DeleteOptions{})
+}
+
+func ForGet(name, ns string, reader Reader) (runtime.Object, error) {
 	ins := &crd.CrdStore{}
 
-	obj, err := config.DynamicClient.Resource(crd.StoreGVR).
-		Namespace(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	obj, err := reader.Get(cluster.Local, crd.StoreGVR, ns, name)
 	if err != nil && errors.IsNotFound(err) {
 		log.Info().Msgf("未找到 %s/%s", ns, name)
 		return &metav1.Status{Reason: "NotFound", Code: 404}, err
 	}
+	if err != nil {
+		return nil, err
+	}
 	if err = ins.FromUnstructured(obj); err != nil {
 		return nil, err
 	}
@@ -120,27 +177,68 @@ func ForGet(name, ns string) (runtime.Object, error) {
 	shadow.Name = name
 	shadow.Namespace = ns
 	shadow.CreationTimestamp = obj.GetCreationTimestamp()
-	shadow.Status.State = ins.Spec.Status
+	shadow.Status.State = ins.State()
+	if ins.Status != nil {
+		shadow.Status.Message = ins.Status.Message
+		shadow.Status.LastTransitionTime = ins.Status.LastTransitionTime
+	}
+	shadow.Status.Revision = ins.Spec.Revision
+	shadow.Spec.TargetCluster = ins.Spec.TargetCluster
+	shadow.Spec.Suspend = ins.Spec.Suspend
+	shadow.ManagedFields = ins.Spec.ManagedFields
 	shadow.UID = types.UID(ins.Spec.ShadowUid)
 
-	var list []any
-	for _, i := range ins.Spec.CrInfoList {
-		gvr := schema.GroupVersionResource{
-			Group:    i.Group,
-			Version:  i.Version,
-			Resource: i.Resource,
+	children, errs := fetchChildren(ins.Spec.CrInfoList, reader)
+	var recorded []v1.FlowItem
+	for _, err := range errs {
+		if err != nil && ins.Spec.Revision > 0 {
+			if recorded, err = GetRevision(name, ns, ins.Spec.Revision); err != nil {
+				log.Warn().Msgf("%s/%s 读取版本 %d 失败 %s", ns, name, ins.Spec.Revision, err)
+			}
+			break
 		}
-
-		opt := metav1.GetOptions{}
-		utd, err := config.DynamicClient.Resource(gvr).
-			Namespace(i.Namespace).Get(context.TODO(), i.Name, opt)
-		if err != nil {
-			return nil, err
+	}
+	// 由source展开的子资源在CrInfoList末尾, 详情中只返回source本身
+	inline := len(ins.Spec.CrInfoList) - ins.Spec.SourceItems
+	shadow.Spec.Source = ins.Spec.Source
+	var list []v1.FlowItem
+	var clusters []v1.ClusterStatus
+	clusterIdx := make(map[string]int)
+	remote := false
+	for idx, i := range ins.Spec.CrInfoList {
+		n, ok := clusterIdx[i.Cluster]
+		if !ok {
+			n = len(clusters)
+			clusterIdx[i.Cluster] = n
+			clusters = append(clusters, v1.ClusterStatus{Name: i.Cluster})
+		}
+		remote = remote || i.Cluster != cluster.Local
+		clusters[n].Children++
+		if errs[idx] != nil {
+			log.Warn().Msgf("%s/%s 获取子资源 %s: %s 失败 %s", ns, name, i.Resource, i.Name, errs[idx])
+			clusters[n].Failed++
+			shadow.Status.ChildErrors = append(shadow.Status.ChildErrors, v1.ChildError{
+				Index:     idx,
+				Cluster:   i.Cluster,
+				Kind:      i.Kind,
+				Namespace: i.Namespace,
+				Name:      i.Name,
+				Message:   errs[idx].Error(),
+			})
+			// 以记录的期望对象占位, 保持条目位置, 基于详情的更新也不会因读取失败清理该子资源
+			if item, ok := recordedItem(recorded, i); ok && idx < inline {
+				list = append(list, item)
+			}
+			continue
+		}
+		if idx < inline {
+			list = append(list, v1.FlowItem{Object: children[idx].Object})
 		}
-		utd.SetManagedFields(nil)
-		list = append(list, utd)
 	}
 	shadow.Spec.FlowList = list
+	if remote {
+		shadow.Status.Clusters = clusters
+	}
 	shadow.UID = types.UID(ins.Spec.ShadowUid)
 
 	opt := k8sjson.SerializerOptions{
@@ -159,14 +257,71 @@ func ForGet(name, ns string) (runtime.Object, error) {
 	return decode, err
 }
 
-func GvkToGvr(gvk *schema.GroupVersionKind) (schema.GroupVersionResource, error) {
-	mapping, err := Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
-	if meta.IsNoMatchError(err) || err != nil {
+// recordedItem 在版本记录中找到子资源对应的条目
+func recordedItem(items []v1.FlowItem, i crd.CrInfo) (v1.FlowItem, bool) {
+	for _, item := range items {
+		obj := unstructured.Unstructured{Object: item.Object}
+		gvk := obj.GroupVersionKind()
+		if gvk.Group != i.Group || gvk.Kind != i.Kind || obj.GetName() != i.Name {
+			continue
+		}
+		if i.Namespaced() && obj.GetNamespace() != i.Namespace {
+			continue
+		}
+		return item, true
+	}
+	return v1.FlowItem{}, false
+}
+
+// fetchChildren 并发获取子资源, 并发数由 config.FetchWorkers 限制, 结果与crInfoList顺序一致
+func fetchChildren(crInfoList []crd.CrInfo, reader Reader) ([]*unstructured.Unstructured, []error) {
+	children := make([]*unstructured.Unstructured, len(crInfoList))
+	errs := make([]error, len(crInfoList))
+	parallel(len(crInfoList), config.FetchWorkers, func(idx int) {
+		i := crInfoList[idx]
+		ns := i.Namespace
+		if !i.Namespaced() {
+			ns = ""
+		}
+		utd, err := reader.Get(i.Cluster, i.GVR(), ns, i.Name)
+		if err != nil {
+			errs[idx] = err
+			return
+		}
+		utd.SetManagedFields(nil)
+		children[idx] = utd
+	})
+	return children, errs
+}
+
+// parallel 以最多workers个并发执行fn(0)...fn(n-1), 全部完成后返回
+func parallel(n, workers int, fn func(idx int)) {
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for idx := 0; idx < n; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn(idx)
+		}(idx)
+	}
+	wg.Wait()
+}
+
+func GvkToGvr(client *cluster.Client, gvk *schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	mapping, err := GetMapping(client, gvk)
+	if err != nil {
 		return schema.GroupVersionResource{}, err
 	}
 	return mapping.Resource, nil
 }
 
+func GetMapping(client *cluster.Client, gvk *schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	return client.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
 func setAnnotation(obj runtime.Object, annotation, key string) error {
 	ants, err := meta.NewAccessor().Annotations(obj)
 	if err != nil {
@@ -179,49 +334,13 @@ func setAnnotation(obj runtime.Object, annotation, key string) error {
 	return meta.NewAccessor().SetAnnotations(obj, ants)
 }
 
-func ForApply(tasks []json.RawMessage, metaAnnotations string) (err error) {
-
-	for idx, js := range tasks {
-		msg := fmt.Sprintf("[%d/%d]", idx+1, len(tasks))
-
-		gvr, utd, err := GetInfoFromBytes(js)
-		if err != nil {
-			return err
-		}
-		log.Info().Msgf("%s 提交资源 %s: %s", msg, gvr.Resource, utd.GetName())
-		if idx == 0 {
-			if err = setAnnotation(utd, metaAnnotations, v1.ShadowKind); err != nil {
-				return err
-			}
-		}
-		opt := metav1.PatchOptions{FieldManager: v1.FieldManager}
-
-		marshalJSON, err := utd.MarshalJSON()
-		if err != nil {
-			return err
-		}
-		_, err = config.DynamicClient.Resource(gvr).
-			Namespace(utd.GetNamespace()).
-			Patch(context.TODO(), utd.GetName(), types.ApplyPatchType, marshalJSON, opt)
-
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
+// GetInfoFromBytes 按本集群解析flowList条目
 func GetInfoFromBytes(bytes json.RawMessage) (gvr schema.GroupVersionResource, utd *unstructured.Unstructured, err error) {
-	obj, gvk, err := Decode(bytes)
-	if err != nil {
-		return gvr, utd, err
-	}
-	gvr, err = GvkToGvr(gvk)
+	item, err := ResolveItem(bytes, cluster.Local)
 	if err != nil {
 		return gvr, utd, err
 	}
-	utd, err = ConvertToUnstructured(obj)
-	return gvr, utd, err
+	return item.GVR, item.Obj, nil
 }
 
 func Decode(data []byte) (obj runtime.Object, gvk *schema.GroupVersionKind, err error) {
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRecordedItem(t *testing.T) {
+	items := []v1.FlowItem{
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap",
+			"metadata": map[string]interface{}{"name": "cfg", "namespace": "default"}}},
+		{Object: map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment",
+			"metadata": map[string]interface{}{"name": "web", "namespace": "default"}}},
+		{Object: map[string]interface{}{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole",
+			"metadata": map[string]interface{}{"name": "web"}}},
+	}
+	tests := []struct {
+		name string
+		info crd.CrInfo
+		want string
+	}{
+		{name: "namespaced", info: crd.CrInfo{Group: "apps", Kind: "Deployment", Namespace: "default", Name: "web"}, want: "Deployment"},
+		{name: "cluster scoped", info: crd.CrInfo{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole", Namespace: "default", Name: "web", Scope: crd.ScopeCluster}, want: "ClusterRole"},
+		{name: "other namespace", info: crd.CrInfo{Kind: "ConfigMap", Namespace: "other", Name: "cfg"}},
+		{name: "other group", info: crd.CrInfo{Group: "example.com", Kind: "Deployment", Namespace: "default", Name: "web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, ok := recordedItem(items, tt.info)
+			if got := item.Object["kind"]; ok != (tt.want != "") || (ok && got != tt.want) {
+				t.Fatalf("recordedItem() = %v, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+// failingReader 模拟缓存或api server读取失败
+type failingReader struct{ err error }
+
+func (r failingReader) Get(string, schema.GroupVersionResource, string, string) (*unstructured.Unstructured, error) {
+	return nil, r.err
+}
+
+func (r failingReader) List(string, schema.GroupVersionResource, string) ([]unstructured.Unstructured, error) {
+	return nil, r.err
+}
+
+func TestForGetReaderError(t *testing.T) {
+	want := apierrors.NewServiceUnavailable("cache unavailable")
+	if _, err := ForGet("app", "default", failingReader{err: want}); err != want {
+		t.Fatalf("ForGet() error = %v, want %v", err, want)
+	}
+}
+
+// objectReader 按名称返回给定的对象
+type objectReader map[string]*unstructured.Unstructured
+
+func (r objectReader) Get(_ string, gvr schema.GroupVersionResource, _, name string) (*unstructured.Unstructured, error) {
+	if obj, ok := r[name]; ok {
+		return obj.DeepCopy(), nil
+	}
+	return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
+}
+
+func (r objectReader) List(string, schema.GroupVersionResource, string) ([]unstructured.Unstructured, error) {
+	return nil, nil
+}
+
+func TestForGetHidesSourceItems(t *testing.T) {
+	source := &v1.FlowSource{ConfigMap: &v1.ConfigMapSource{Name: "app-manifests"}}
+	shim := &crd.CrdStore{}
+	shim.APIVersion = crd.StoreApiVersion
+	shim.Kind = crd.StoreKind
+	shim.Namespace = "default"
+	shim.Name = "app"
+	shim.Spec.Source = source
+	shim.Spec.SourceItems = 1
+	reader := objectReader{}
+	for _, name := range []string{"inline", "from-source"} {
+		shim.Spec.CrInfoList = append(shim.Spec.CrInfoList,
+			crd.CrInfo{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: name})
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		reader[name] = obj
+	}
+	utd, err := ConvertToUnstructured(shim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader["app"] = utd
+
+	obj, err := ForGet("app", "default", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow := obj.(*unstructured.Unstructured).Object
+	items, _, _ := unstructured.NestedSlice(shadow, "spec", "flowList")
+	if len(items) != 1 || items[0].(map[string]interface{})["metadata"].(map[string]interface{})["name"] != "inline" {
+		t.Fatalf("ForGet() flowList = %v, want only the inline item", items)
+	}
+	if name, _, _ := unstructured.NestedString(shadow, "spec", "source", "configMap", "name"); name != source.ConfigMap.Name {
+		t.Fatalf("ForGet() source configMap = %q, want %q", name, source.ConfigMap.Name)
+	}
+}
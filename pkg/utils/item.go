@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"encoding/json"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Item 解析后的flowList条目
+type Item struct {
+	Cluster    string
+	GVR        schema.GroupVersionResource
+	Namespaced bool
+	Obj        *unstructured.Unstructured
+}
+
+// ResolveItem 解码flowList条目, 按目标集群的mapper解析gvr.
+// 条目上的 apis.abc.com/target-cluster 注解优先于shadow的 spec.targetCluster
+func ResolveItem(js json.RawMessage, defaultCluster string) (*Item, error) {
+	obj, gvk, err := Decode(js)
+	if err != nil {
+		return nil, err
+	}
+	utd, err := ConvertToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	name := defaultCluster
+	if str := utd.GetAnnotations()[v1.ClusterAnnotation]; str != "" {
+		name = str
+	}
+	client, err := cluster.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := GetMapping(client, gvk)
+	if err != nil {
+		return nil, err
+	}
+	return &Item{
+		Cluster:    name,
+		GVR:        mapping.Resource,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+		Obj:        utd,
+	}, nil
+}
+
+func (i *Item) CrInfo() crd.CrInfo {
+	scope := crd.ScopeNamespaced
+	if !i.Namespaced {
+		scope = crd.ScopeCluster
+	}
+	return crd.CrInfo{
+		Cluster:   i.Cluster,
+		Group:     i.GVR.Group,
+		Version:   i.GVR.Version,
+		Kind:      i.Obj.GetKind(),
+		Resource:  i.GVR.Resource,
+		Namespace: i.Obj.GetNamespace(),
+		Name:      i.Obj.GetName(),
+		Scope:     scope,
+	}
+}
+
+// Resource 返回操作该条目的客户端, 集群级别的资源不带命名空间
+func (i *Item) Resource(client *cluster.Client) dynamic.ResourceInterface {
+	if !i.Namespaced {
+		return client.Resource(i.GVR)
+	}
+	return client.Resource(i.GVR).Namespace(i.Obj.GetNamespace())
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// SplitManifests 将yaml或json文本拆分为flowList条目, 支持以 --- 分隔的多个文档, 空文档会被跳过.
+// 每个文档都经过 Decode 校验, kind: List 文档会被展开为其中的条目
+func SplitManifests(data []byte) ([]json.RawMessage, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var items []json.RawMessage
+	for doc := 0; ; doc++ {
+		var obj map[string]interface{}
+		err := decoder.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		js, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		decoded, _, err := Decode(js)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		list, ok := decoded.(*unstructured.UnstructuredList)
+		if !ok {
+			items = append(items, js)
+			continue
+		}
+		for _, i := range list.Items {
+			js, err = i.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, bytes.TrimSpace(js))
+		}
+	}
+}
+
+// ReadManifestDir 按文件名顺序读取目录下的 .yaml .yml .json 文件, 不递归子目录
+func ReadManifestDir(dir string) ([]json.RawMessage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	var items []json.RawMessage
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		docs, err := SplitManifests(data)
+		if err != nil {
+			return nil, &os.PathError{Op: "decode", Path: filepath.Join(dir, name), Err: err}
+		}
+		items = append(items, docs...)
+	}
+	return items, nil
+}
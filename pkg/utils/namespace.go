@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/inksnw/shadowresource/pkg/config"
+)
+
+// DefaultNamespace 未设置命名空间的namespaced子资源默认放到shadow所在的命名空间.
+// 无法解析的条目原样返回, 由Validate报告
+func DefaultNamespace(tasks []json.RawMessage, ns, defaultCluster string) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, 0, len(tasks))
+	for _, js := range tasks {
+		item, err := ResolveItem(js, defaultCluster)
+		if err != nil || !item.Namespaced || item.Obj.GetNamespace() != "" {
+			out = append(out, js)
+			continue
+		}
+		item.Obj.SetNamespace(ns)
+		b, err := item.Obj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// CrossNamespaceAllowed shadow所在的命名空间src能否在target中创建子资源.
+// 规则来自 config.CrossNamespacePolicy, 格式为 src:target, 两边都可以是 *
+func CrossNamespaceAllowed(src, target string) bool {
+	if src == target {
+		return true
+	}
+	for _, rule := range config.CrossNamespacePolicy {
+		from, to, ok := strings.Cut(rule, ":")
+		if !ok {
+			continue
+		}
+		if (from == "*" || from == src) && (to == "*" || to == target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterScopedAllowed shadow所在的命名空间src能否创建集群级别的子资源
+func ClusterScopedAllowed(src string) bool {
+	for _, ns := range config.ClusterScopedNamespaces {
+		if ns == "*" || ns == src {
+			return true
+		}
+	}
+	return false
+}
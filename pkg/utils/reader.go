@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Reader 读取shim与子资源, 可以直接请求api server, 也可以来自informer缓存.
+// 集群级别的资源ns传空
+type Reader interface {
+	Get(cluster string, gvr schema.GroupVersionResource, ns, name string) (*unstructured.Unstructured, error)
+	List(cluster string, gvr schema.GroupVersionResource, ns string) ([]unstructured.Unstructured, error)
+}
+
+// LiveReader 每次都请求api server
+var LiveReader Reader = liveReader{}
+
+type liveReader struct{}
+
+func (liveReader) Get(name string, gvr schema.GroupVersionResource, ns, objName string) (*unstructured.Unstructured, error) {
+	client, err := cluster.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if ns == "" {
+		return client.Resource(gvr).Get(context.TODO(), objName, metav1.GetOptions{})
+	}
+	return client.Resource(gvr).Namespace(ns).Get(context.TODO(), objName, metav1.GetOptions{})
+}
+
+func (liveReader) List(name string, gvr schema.GroupVersionResource, ns string) ([]unstructured.Unstructured, error) {
+	client, err := cluster.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(gvr).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"encoding/json"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// RebaseItems 详情中的子资源是集群中的对象, 带有服务端补全的默认值. 将更新请求相对详情的修改应用到
+// 版本记录的期望对象上, 新版本与导出结果因此不含默认值. 详情或记录中没有的条目只去掉服务端字段
+func RebaseItems(live, submitted, recorded []v1.FlowItem) ([]v1.FlowItem, error) {
+	out := make([]v1.FlowItem, 0, len(submitted))
+	for _, item := range submitted {
+		from, ok := findItem(live, item)
+		desired, found := findItem(recorded, item)
+		if !ok || !found {
+			obj := item.DeepCopy().Object
+			StripServerFields(obj)
+			out = append(out, v1.FlowItem{Object: obj})
+			continue
+		}
+		obj, err := rebaseItem(from.Object, item.Object, desired.Object)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v1.FlowItem{Object: obj})
+	}
+	return out, nil
+}
+
+// findItem 按组、类型、命名空间与名称查找同一个对象
+func findItem(items []v1.FlowItem, item v1.FlowItem) (v1.FlowItem, bool) {
+	want := unstructured.Unstructured{Object: item.Object}
+	for _, i := range items {
+		obj := unstructured.Unstructured{Object: i.Object}
+		if obj.GroupVersionKind().GroupKind() == want.GroupVersionKind().GroupKind() &&
+			obj.GetNamespace() == want.GetNamespace() && obj.GetName() == want.GetName() {
+			return i, true
+		}
+	}
+	return v1.FlowItem{}, false
+}
+
+// rebaseItem 内置类型使用strategic merge patch, 列表按合并键逐项修改, 其它类型使用json merge patch
+func rebaseItem(live, submitted, desired map[string]interface{}) (map[string]interface{}, error) {
+	original, err := json.Marshal(live)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := json.Marshal(submitted)
+	if err != nil {
+		return nil, err
+	}
+	base, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+	var merged []byte
+	gvk := (&unstructured.Unstructured{Object: submitted}).GroupVersionKind()
+	if typed, err := scheme.Scheme.New(gvk); err == nil {
+		patch, err := strategicpatch.CreateTwoWayMergePatch(original, modified, typed)
+		if err != nil {
+			return nil, err
+		}
+		if merged, err = strategicpatch.StrategicMergePatch(base, patch, typed); err != nil {
+			return nil, err
+		}
+	} else {
+		patch, err := jsonpatch.CreateMergePatch(original, modified)
+		if err != nil {
+			return nil, err
+		}
+		if merged, err = jsonpatch.MergePatch(base, patch); err != nil {
+			return nil, err
+		}
+	}
+	obj := map[string]interface{}{}
+	if err = json.Unmarshal(merged, &obj); err != nil {
+		return nil, err
+	}
+	StripServerFields(obj)
+	return obj, nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func deployment(image string, defaults bool) map[string]interface{} {
+	container := map[string]interface{}{"name": "web", "image": image}
+	obj := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": float64(1),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{container},
+			}},
+		},
+	}
+	if defaults {
+		container["imagePullPolicy"] = "IfNotPresent"
+		container["terminationMessagePath"] = "/dev/termination-log"
+		_ = unstructured.SetNestedField(obj, "RollingUpdate", "spec", "strategy", "type")
+		_ = unstructured.SetNestedField(obj, "123", "metadata", "resourceVersion")
+		_ = unstructured.SetNestedField(obj, float64(1), "status", "readyReplicas")
+	}
+	return obj
+}
+
+func TestRebaseItems(t *testing.T) {
+	live := []v1.FlowItem{{Object: deployment("nginx:1.24", true)}}
+	recorded := []v1.FlowItem{{Object: deployment("nginx:1.24", false)}}
+
+	submitted := v1.FlowItem{Object: deployment("nginx:1.25", true)}
+	_ = unstructured.SetNestedField(submitted.Object, float64(3), "spec", "replicas")
+	custom := v1.FlowItem{Object: map[string]interface{}{"apiVersion": "example.com/v1", "kind": "Widget",
+		"metadata": map[string]interface{}{"name": "w", "namespace": "default", "resourceVersion": "7"},
+		"spec":     map[string]interface{}{"size": "large"}}}
+
+	got, err := RebaseItems(live, []v1.FlowItem{submitted, custom}, recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := deployment("nginx:1.25", false)
+	_ = unstructured.SetNestedField(want, float64(3), "spec", "replicas")
+	if !reflect.DeepEqual(got[0].Object, want) {
+		t.Errorf("rebased deployment = %v, want %v", got[0].Object, want)
+	}
+	if _, ok, _ := unstructured.NestedString(got[1].Object, "metadata", "resourceVersion"); ok {
+		t.Errorf("new item keeps resourceVersion: %v", got[1].Object)
+	}
+	if _, ok, _ := unstructured.NestedString(submitted.Object, "metadata", "resourceVersion"); !ok {
+		t.Errorf("submitted item was modified")
+	}
+}
+
+func TestRebaseItemsMergePatch(t *testing.T) {
+	widget := func(size string, defaults bool) map[string]interface{} {
+		spec := map[string]interface{}{"size": size}
+		if defaults {
+			spec["replicas"] = float64(1)
+		}
+		return map[string]interface{}{"apiVersion": "example.com/v1", "kind": "Widget",
+			"metadata": map[string]interface{}{"name": "w", "namespace": "default"}, "spec": spec}
+	}
+	got, err := RebaseItems([]v1.FlowItem{{Object: widget("small", true)}},
+		[]v1.FlowItem{{Object: widget("large", true)}}, []v1.FlowItem{{Object: widget("small", false)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := widget("large", false); !reflect.DeepEqual(got[0].Object, want) {
+		t.Errorf("rebased widget = %v, want %v", got[0].Object, want)
+	}
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/config"
+	"github.com/phuslu/log"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+)
+
+// RevisionHistoryLimit 每个shadow保留的历史版本数
+const RevisionHistoryLimit = 10
+
+// ErrRevisionNotFound 指定的版本不存在或已被清理
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type revisionData struct {
+	FlowList []json.RawMessage `json:"flowList"`
+}
+
+// revisionSelector 子资源也带有shadow名称标签, 同时要求版本hash标签才是shadow的历史版本
+func revisionSelector(name string) string {
+	return labels.Set{v1.ShadowNameLabel: name}.String() + "," + v1.RevisionHashLabel
+}
+
+// revisionName 加上前缀, 避免与命名空间中其它ControllerRevision重名
+func revisionName(name string, revision int64) string {
+	return fmt.Sprintf("shadow-%s-%d", name, revision)
+}
+
+// revisionItems 去掉服务端字段与shadow写入的标签注解, 只记录期望状态.
+// 从详情读出再提交的条目带有resourceVersion、status等, 不去掉时每次状态变化都会产生新版本
+func revisionItems(tasks []json.RawMessage) ([]json.RawMessage, error) {
+	items := make([]json.RawMessage, 0, len(tasks))
+	for _, js := range tasks {
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(js, &obj); err != nil {
+			return nil, err
+		}
+		StripServerFields(obj)
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, data)
+	}
+	return items, nil
+}
+
+func revisionHash(data []byte) string {
+	h := fnv.New32a()
+	h.Write(data)
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+// ListRevisions 按版本号升序返回shadow的历史版本
+func ListRevisions(name, ns string) ([]appsv1.ControllerRevision, error) {
+	opt := metav1.ListOptions{LabelSelector: revisionSelector(name)}
+	list, err := config.K8sClient.AppsV1().ControllerRevisions(ns).List(context.TODO(), opt)
+	if err != nil {
+		return nil, err
+	}
+	revisions := list.Items
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+// SaveRevision 记录本次提交的flowList, 内容与最新版本一致时直接返回最新版本号.
+// 并发的提交可能先占用了同一版本号, 此时重新读取版本列表并使用下一个版本号
+func SaveRevision(name, ns string, tasks []json.RawMessage) (int64, error) {
+	items, err := revisionItems(tasks)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(revisionData{FlowList: items})
+	if err != nil {
+		return 0, err
+	}
+	hash := revisionHash(data)
+
+	var revisions []appsv1.ControllerRevision
+	var next, floor int64
+	created := false
+	err = retry.OnError(retry.DefaultRetry, apierrors.IsAlreadyExists, func() error {
+		if revisions, err = ListRevisions(name, ns); err != nil {
+			return err
+		}
+		next = 1
+		if n := len(revisions); n > 0 {
+			latest := revisions[n-1]
+			if latest.Labels[v1.RevisionHashLabel] == hash {
+				next = latest.Revision
+				return nil
+			}
+			next = latest.Revision + 1
+		}
+		if next < floor {
+			next = floor
+		}
+		floor = next + 1
+		cr := &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      revisionName(name, next),
+				Namespace: ns,
+				Labels: map[string]string{
+					v1.ShadowNameLabel:   name,
+					v1.RevisionHashLabel: hash,
+				},
+			},
+			Data:     runtime.RawExtension{Raw: data},
+			Revision: next,
+		}
+		_, err := config.K8sClient.AppsV1().ControllerRevisions(ns).
+			Create(context.TODO(), cr, metav1.CreateOptions{FieldManager: v1.FieldManager})
+		created = err == nil
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !created {
+		return next, nil
+	}
+	log.Info().Msgf("%s/%s 记录版本 %d", ns, name, next)
+
+	for len(revisions)+1 > RevisionHistoryLimit {
+		oldest := revisions[0]
+		revisions = revisions[1:]
+		err = config.K8sClient.AppsV1().ControllerRevisions(ns).
+			Delete(context.TODO(), oldest.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return next, err
+		}
+	}
+	return next, nil
+}
+
+// GetRevision 取出指定版本记录的flowList
+func GetRevision(name, ns string, revision int64) ([]v1.FlowItem, error) {
+	revisions, err := ListRevisions(name, ns)
+	if err != nil {
+		return nil, err
+	}
+	for _, cr := range revisions {
+		if cr.Revision != revision {
+			continue
+		}
+		var data struct {
+			FlowList []v1.FlowItem `json:"flowList"`
+		}
+		if err = json.Unmarshal(cr.Data.Raw, &data); err != nil {
+			return nil, err
+		}
+		// 旧版本可能记录了resourceVersion、status等, resourceVersion早已过期, 作为apply的前置条件会导致冲突
+		for _, item := range data.FlowList {
+			StripServerFields(item.Object)
+		}
+		return data.FlowList, nil
+	}
+	return nil, fmt.Errorf("%w: revision %d of %s/%s", ErrRevisionNotFound, revision, ns, name)
+}
+
+func ForDeleteRevisions(name, ns string) error {
+	opt := metav1.ListOptions{LabelSelector: revisionSelector(name)}
+	return config.K8sClient.AppsV1().ControllerRevisions(ns).
+		DeleteCollection(context.TODO(), metav1.DeleteOptions{}, opt)
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/config"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRevisionItemsIgnoresServerFields(t *testing.T) {
+	desired := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cfg","namespace":"default"},"data":{"k":"v"}}`
+	live := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cfg","namespace":"default",
+		"uid":"1","resourceVersion":"42","generation":3,"creationTimestamp":"2023-01-01T00:00:00Z",
+		"labels":{"apis.abc.com/shadow-name":"app","apis.abc.com/shadow-namespace":"default","apis.abc.com/shadow-uid":"u"},
+		"annotations":{"ShadowResource":"{}"}},"data":{"k":"v"},"status":{"phase":"x"}}`
+
+	a, err := revisionItems([]json.RawMessage{json.RawMessage(desired)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := revisionItems([]json.RawMessage{json.RawMessage(live)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a[0]) != string(b[0]) {
+		t.Fatalf("revisionItems() differ:\n%s\n%s", a[0], b[0])
+	}
+}
+
+func TestSaveRevisionRetriesTakenNumber(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: revisionName("app", 1), Namespace: "default",
+			Labels: map[string]string{v1.ShadowNameLabel: "app", v1.RevisionHashLabel: "old"}},
+		Revision: 1,
+	})
+	// 第一次创建时模拟另一个提交先记录了版本2
+	raced := false
+	client.PrependReactor("create", "controllerrevisions", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if raced {
+			return false, nil, nil
+		}
+		raced = true
+		other := &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: revisionName("app", 2), Namespace: "default",
+				Labels: map[string]string{v1.ShadowNameLabel: "app", v1.RevisionHashLabel: "other"}},
+			Revision: 2,
+		}
+		if err := client.Tracker().Add(other); err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewAlreadyExists(appsv1.Resource("controllerrevisions"), other.Name)
+	})
+	saved := config.K8sClient
+	config.K8sClient = client
+	defer func() { config.K8sClient = saved }()
+
+	task := json.RawMessage(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cfg","namespace":"default"}}`)
+	revision, err := SaveRevision("app", "default", []json.RawMessage{task})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != 3 {
+		t.Fatalf("SaveRevision() = %d, want 3", revision)
+	}
+	if _, err = GetRevision("app", "default", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetRevision("app", "default", 7); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("GetRevision() of a missing revision = %v, want ErrRevisionNotFound", err)
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ExpandSource 读取spec.source中的清单, 解码为flowList条目
+func ExpandSource(src *v1.FlowSource, ns string) ([]v1.FlowItem, field.ErrorList) {
+	path := field.NewPath("spec", "source")
+	var docs []json.RawMessage
+	var errs field.ErrorList
+	if src.Manifests != "" {
+		items, err := SplitManifests([]byte(src.Manifests))
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child("manifests"), "", err.Error()))
+		}
+		docs = append(docs, items...)
+	}
+	if src.ConfigMap != nil {
+		items, cmErrs := readConfigMap(src.ConfigMap, ns, path.Child("configMap"))
+		errs = append(errs, cmErrs...)
+		docs = append(docs, items...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	flowList := make([]v1.FlowItem, 0, len(docs))
+	for _, js := range docs {
+		var item v1.FlowItem
+		if err := json.Unmarshal(js, &item); err != nil {
+			return nil, field.ErrorList{field.InternalError(path, err)}
+		}
+		flowList = append(flowList, item)
+	}
+	return flowList, nil
+}
+
+func readConfigMap(src *v1.ConfigMapSource, ns string, path *field.Path) ([]json.RawMessage, field.ErrorList) {
+	cm, err := config.K8sClient.CoreV1().ConfigMaps(ns).Get(context.TODO(), src.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, field.ErrorList{field.NotFound(path.Child("name"), src.Name)}
+	}
+	if err != nil {
+		return nil, field.ErrorList{field.InternalError(path, err)}
+	}
+	keys := src.Keys
+	if len(keys) == 0 {
+		for k := range cm.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	var docs []json.RawMessage
+	var errs field.ErrorList
+	for idx, k := range keys {
+		data, ok := cm.Data[k]
+		if !ok {
+			errs = append(errs, field.NotFound(path.Child("keys").Index(idx), k))
+			continue
+		}
+		items, err := SplitManifests([]byte(data))
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child("keys").Index(idx), k, err.Error()))
+			continue
+		}
+		docs = append(docs, items...)
+	}
+	return docs, errs
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/crd"
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"github.com/inksnw/shadowresource/pkg/events"
+	"github.com/phuslu/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// suspendFields 支持暂停的资源与暂停时改写的spec字段, Deployment/StatefulSet缩容到0, Job/CronJob设置suspend
+var suspendFields = map[schema.GroupKind]string{
+	{Group: "apps", Kind: "Deployment"}:  "replicas",
+	{Group: "apps", Kind: "StatefulSet"}: "replicas",
+	{Group: "batch", Kind: "Job"}:        "suspend",
+	{Group: "batch", Kind: "CronJob"}:    "suspend",
+}
+
+// PrepareSuspend 记录支持暂停的子资源的原始值, 并返回将这些字段改为暂停值的flowList.
+// 已经暂停的子资源沿用 previous 中的记录, 其余记录集群中的当前值, 不存在时记录flowList中的值.
+// flowList中未设置该字段的已有资源不在提交时改写, 避免与其它field manager(如HPA)冲突, 由 ForSuspend 补上
+func PrepareSuspend(tasks []json.RawMessage, defaultCluster string, previous []crd.SuspendedChild) ([]json.RawMessage, []crd.SuspendedChild, error) {
+	recorded := make(map[crd.CrInfo]crd.SuspendedChild, len(previous))
+	for _, c := range previous {
+		recorded[childKey(c.CrInfo)] = c
+	}
+	out := make([]json.RawMessage, 0, len(tasks))
+	var children []crd.SuspendedChild
+	for _, js := range tasks {
+		item, err := ResolveItem(js, defaultCluster)
+		if err != nil {
+			return nil, nil, err
+		}
+		field, ok := suspendFields[item.Obj.GroupVersionKind().GroupKind()]
+		if !ok {
+			out = append(out, js)
+			continue
+		}
+		live, err := LiveReader.Get(item.Cluster, item.GVR, item.Obj.GetNamespace(), item.Obj.GetName())
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, nil, err
+		}
+		exists := err == nil
+		child, ok := recorded[childKey(item.CrInfo())]
+		if !ok {
+			child = crd.SuspendedChild{CrInfo: item.CrInfo()}
+			if exists {
+				recordOriginal(&child, live, field)
+			} else {
+				recordOriginal(&child, item.Obj, field)
+			}
+		}
+		children = append(children, child)
+
+		if _, declared, _ := unstructured.NestedFieldNoCopy(item.Obj.Object, "spec", field); declared || !exists {
+			// 改写原始条目而不是解码后的对象, 避免提交解码补上的空字段
+			obj := map[string]interface{}{}
+			if err = json.Unmarshal(js, &obj); err != nil {
+				return nil, nil, err
+			}
+			if err = setSuspendValue(obj, field); err != nil {
+				return nil, nil, err
+			}
+			if js, err = json.Marshal(obj); err != nil {
+				return nil, nil, err
+			}
+		}
+		out = append(out, js)
+	}
+	return out, children, nil
+}
+
+func recordOriginal(child *crd.SuspendedChild, obj *unstructured.Unstructured, field string) {
+	switch field {
+	case "replicas":
+		if n, ok, _ := unstructured.NestedInt64(obj.Object, "spec", field); ok {
+			child.Replicas = &n
+		}
+	case "suspend":
+		if b, ok, _ := unstructured.NestedBool(obj.Object, "spec", field); ok {
+			child.Suspend = &b
+		}
+	}
+}
+
+func setSuspendValue(obj map[string]interface{}, field string) error {
+	if field == "replicas" {
+		return unstructured.SetNestedField(obj, int64(0), "spec", field)
+	}
+	return unstructured.SetNestedField(obj, true, "spec", field)
+}
+
+// ForSuspend 以merge patch将记录的子资源改为暂停值, 不会与其它field manager冲突
+func ForSuspend(ref *corev1.ObjectReference, children []crd.SuspendedChild) error {
+	for _, c := range children {
+		if err := patchSuspend(c, true); err != nil {
+			events.Warning(ref, events.ReasonApplyFailed, "Failed to suspend %s: %s", c.CrInfo, err)
+			return err
+		}
+		log.Info().Msgf("暂停子资源 %s", c.CrInfo)
+	}
+	if len(children) > 0 {
+		events.Normal(ref, events.ReasonSuspended, "Suspended %d children", len(children))
+	}
+	return nil
+}
+
+// ForResume 将暂停的子资源恢复为记录的原始值. flowList中设置了该字段的子资源已经在提交时恢复,
+// 不在flowList中的子资源已被清理, 都会跳过
+func ForResume(ref *corev1.ObjectReference, tasks []json.RawMessage, defaultCluster string, children []crd.SuspendedChild) error {
+	declared := make(map[crd.CrInfo]bool)
+	for _, js := range tasks {
+		item, err := ResolveItem(js, defaultCluster)
+		if err != nil {
+			return err
+		}
+		field, ok := suspendFields[item.Obj.GroupVersionKind().GroupKind()]
+		if !ok {
+			continue
+		}
+		declared[childKey(item.CrInfo())] = declaresValue(item.Obj, field)
+	}
+	for _, c := range children {
+		set, ok := declared[childKey(c.CrInfo)]
+		if !ok || set {
+			continue
+		}
+		if err := patchSuspend(c, false); err != nil && !errors.IsNotFound(err) {
+			events.Warning(ref, events.ReasonApplyFailed, "Failed to resume %s: %s", c.CrInfo, err)
+			return err
+		}
+		log.Info().Msgf("恢复子资源 %s", c.CrInfo)
+	}
+	if len(children) > 0 {
+		events.Normal(ref, events.ReasonResumed, "Resumed %d children", len(children))
+	}
+	return nil
+}
+
+// declaresValue flowList中设置了该字段且不是暂停值. 从暂停中的shadow读出再提交时字段为暂停值, 仍按记录恢复
+func declaresValue(obj *unstructured.Unstructured, field string) bool {
+	if field == "replicas" {
+		n, ok, _ := unstructured.NestedInt64(obj.Object, "spec", field)
+		return ok && n != 0
+	}
+	b, ok, _ := unstructured.NestedBool(obj.Object, "spec", field)
+	return ok && !b
+}
+
+// patchSuspend 暂停时写入0或true, 恢复时写入原始值, 原始值为空时删除字段由服务端补全默认值
+func patchSuspend(c crd.SuspendedChild, suspend bool) error {
+	field, ok := suspendFields[schema.GroupKind{Group: c.Group, Kind: c.Kind}]
+	if !ok {
+		return fmt.Errorf("%s can not be suspended", c.CrInfo)
+	}
+	var value interface{}
+	switch {
+	case suspend && field == "replicas":
+		value = 0
+	case suspend:
+		value = true
+	case field == "replicas" && c.Replicas != nil:
+		value = *c.Replicas
+	case field == "suspend" && c.Suspend != nil:
+		value = *c.Suspend
+	}
+	data, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{field: value}})
+	if err != nil {
+		return err
+	}
+	client, err := cluster.Get(c.Cluster)
+	if err != nil {
+		return err
+	}
+	opt := metav1.PatchOptions{FieldManager: v1.FieldManager}
+	_, err = client.Resource(c.GVR()).Namespace(c.Namespace).
+		Patch(context.TODO(), c.Name, types.MergePatchType, data, opt)
+	return err
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/inksnw/shadowresource/pkg/apis/shadowresource/v1"
+	"github.com/inksnw/shadowresource/pkg/cluster"
+	"github.com/inksnw/shadowresource/pkg/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// flowNamespaces 由flowList自身创建的命名空间, 其中的资源在dry-run时还不存在
+type flowNamespaces map[string]bool
+
+// observe 按flowList顺序记录其中的命名空间
+func (n flowNamespaces) observe(item *Item) {
+	if item.GVR.Group == "" && item.GVR.Resource == "namespaces" {
+		n[item.Cluster+"/"+item.Obj.GetName()] = true
+	}
+}
+
+// creates 子资源所在的命名空间由flowList中在它之前的条目创建
+func (n flowNamespaces) creates(item *Item) bool {
+	return item.Namespaced && n[item.Cluster+"/"+item.Obj.GetNamespace()]
+}
+
+type validItem struct {
+	path *field.Path
+	item *Item
+}
+
+// Validate 提交前检查整个flowList: 解码, 解析gvr, 命名空间规则, 重复条目, 并对每个子资源做server-side dry-run.
+// 所有问题一起返回, 路径形如 spec.flowList[2].metadata.name
+// adopt为true时每个子资源都必须已经存在, 且接管后内容不变
+func Validate(tasks []json.RawMessage, ns, defaultCluster string, adopt bool) field.ErrorList {
+	var allErrs field.ErrorList
+	root := field.NewPath("spec", "flowList")
+	seen := make(map[string]int)
+	namespaces := make(flowNamespaces)
+	var valid []validItem
+
+	for idx, js := range tasks {
+		path := root.Index(idx)
+		item, errs := validateItem(js, ns, defaultCluster, path)
+		if len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		key := fmt.Sprintf("%s/%s/%s/%s", item.Cluster, item.Obj.GroupVersionKind().GroupKind(),
+			item.Obj.GetNamespace(), item.Obj.GetName())
+		if first, ok := seen[key]; ok {
+			allErrs = append(allErrs, field.Duplicate(path, fmt.Sprintf("%s %s/%s, same as %s", item.Obj.GetKind(),
+				item.Obj.GetNamespace(), item.Obj.GetName(), root.Index(first))))
+			continue
+		}
+		seen[key] = idx
+		namespaces.observe(item)
+		if !adopt && namespaces.creates(item) {
+			continue
+		}
+		valid = append(valid, validItem{path: path, item: item})
+	}
+
+	dryRunErrs := make([]field.ErrorList, len(valid))
+	parallel(len(valid), config.ApplyWorkers, func(idx int) {
+		v := valid[idx]
+		if adopt {
+			dryRunErrs[idx] = adoptErrors(v.path, v.item, checkAdopt(v.item))
+			return
+		}
+		if _, err := patchItem(v.item, true); err != nil {
+			dryRunErrs[idx] = dryRunErrors(v.path, err)
+		}
+	})
+	for _, errs := range dryRunErrs {
+		allErrs = append(allErrs, errs...)
+	}
+	return allErrs
+}
+
+func validateItem(js json.RawMessage, ns, defaultCluster string, path *field.Path) (*Item, field.ErrorList) {
+	var errs field.ErrorList
+	obj, gvk, err := Decode(js)
+	switch {
+	case runtime.IsMissingKind(err):
+		return nil, append(errs, field.Required(path.Child("kind"), ""))
+	case runtime.IsMissingVersion(err):
+		return nil, append(errs, field.Required(path.Child("apiVersion"), ""))
+	case err != nil:
+		return nil, append(errs, field.Invalid(path, string(js), err.Error()))
+	}
+	utd, err := ConvertToUnstructured(obj)
+	if err != nil {
+		return nil, append(errs, field.Invalid(path, string(js), err.Error()))
+	}
+	if utd.GetName() == "" {
+		errs = append(errs, field.Required(path.Child("metadata", "name"), ""))
+	}
+
+	name := defaultCluster
+	clusterPath := field.NewPath("spec", "targetCluster")
+	if str := utd.GetAnnotations()[v1.ClusterAnnotation]; str != "" {
+		name = str
+		clusterPath = path.Child("metadata", "annotations").Key(v1.ClusterAnnotation)
+	}
+	client, err := cluster.Get(name)
+	if err != nil {
+		return nil, append(errs, field.Invalid(clusterPath, name, err.Error()))
+	}
+	mapping, err := GetMapping(client, gvk)
+	if err != nil {
+		return nil, append(errs, field.Invalid(path.Child("kind"), gvk.Kind, err.Error()))
+	}
+	item := &Item{
+		Cluster:    name,
+		GVR:        mapping.Resource,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+		Obj:        utd,
+	}
+
+	nsPath := path.Child("metadata", "namespace")
+	switch {
+	case item.Namespaced && utd.GetNamespace() == "":
+		errs = append(errs, field.Required(nsPath, fmt.Sprintf("%s is namespaced", gvk.Kind)))
+	case item.Namespaced && !CrossNamespaceAllowed(ns, utd.GetNamespace()):
+		errs = append(errs, field.Forbidden(nsPath,
+			fmt.Sprintf("shadows in %q may not create children in %q", ns, utd.GetNamespace())))
+	case !item.Namespaced && utd.GetNamespace() != "":
+		errs = append(errs, field.Invalid(nsPath, utd.GetNamespace(),
+			fmt.Sprintf("%s is cluster-scoped and must not set a namespace", gvk.Kind)))
+	case !item.Namespaced && !ClusterScopedAllowed(ns):
+		errs = append(errs, field.Forbidden(path.Child("kind"),
+			fmt.Sprintf("shadows in %q may not create cluster-scoped %s", ns, gvk.Kind)))
+	}
+	return item, errs
+}
+
+// dryRunErrors 将dry-run返回的字段错误挂到条目路径下
+func dryRunErrors(path *field.Path, err error) field.ErrorList {
+	var errs field.ErrorList
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if details := status.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				if cause.Field == "" {
+					continue
+				}
+				errs = append(errs, field.Forbidden(path.Child(cause.Field), "rejected by dry-run: "+cause.Message))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, field.Forbidden(path, "rejected by dry-run: "+err.Error()))
+	}
+	return errs
+}